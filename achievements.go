@@ -0,0 +1,139 @@
+package main
+
+import (
+	"time"
+)
+
+// What's kept about the player, across every region and mode.
+type player struct {
+	// When the player first played.
+	Since		time.Time
+	// The last day the player went hunting, like "2016-04-01".
+	LastHunt	string
+	// Days in a row the player went hunting, up to the last hunt.
+	Streak		int
+	// The most days in a row the player ever went hunting.
+	BestStreak	int
+	// When each achievement was unlocked, keyed by name.
+	Unlocked	map[string]time.Time
+}
+
+func newPlayer() *player {
+	return &player{Since: time.Now(), Unlocked: map[string]time.Time{}}
+}
+
+// The player went hunting. Hunting every day keeps the streak going.
+func (p *player) hunt(now time.Time) {
+	day := now.Format("2006-01-02")
+	if day == p.LastHunt {
+		return
+	}
+	if p.LastHunt == now.AddDate(0, 0, -1).Format("2006-01-02") {
+		p.Streak++
+	} else {
+		p.Streak = 1
+	}
+	p.LastHunt = day
+	if p.Streak > p.BestStreak {
+		p.BestStreak = p.Streak
+	}
+}
+
+// Returns the streak as of now. A day without hunting breaks it,
+// but today isn't over yet.
+func (p *player) streak(now time.Time) int {
+	switch p.LastHunt {
+	case now.Format("2006-01-02"), now.AddDate(0, 0, -1).Format("2006-01-02"):
+		return p.Streak
+	default:
+		return 0
+	}
+}
+
+// Everything achievements are judged on, over every mode in every
+// region.
+type record struct {
+	Caught		uint
+	Tagged		uint
+	Killed		uint
+	// Zero if nothing was caught.
+	QuickestCatch	time.Duration
+	DeepestCatch	int
+	// How long since the last kill, or since the player started
+	// if nothing was ever killed.
+	SinceKill	time.Duration
+	BestStreak	int
+}
+
+// Sums up the player's record from every region.
+func (rs *regionSet) record(now time.Time) *record {
+	rec := &record{BestStreak: rs.player.BestStreak}
+	lastKill := rs.player.Since
+	for _, df := range rs.regions {
+		for _, s := range df.stats {
+			rec.Caught += s.Caught
+			rec.Tagged += s.Tagged
+			rec.Killed += s.Killed
+			if s.QuickestCatch > 0 && (rec.QuickestCatch == 0 || s.QuickestCatch < rec.QuickestCatch) {
+				rec.QuickestCatch = s.QuickestCatch
+			}
+			if s.DeepestCatch > rec.DeepestCatch {
+				rec.DeepestCatch = s.DeepestCatch
+			}
+		}
+		for _, g := range df.graves {
+			if g.Died.After(lastKill) {
+				lastKill = g.Died
+			}
+		}
+	}
+	rec.SinceKill = now.Sub(lastKill)
+	return rec
+}
+
+// Something the player can earn. Once unlocked, it stays unlocked.
+type achievement struct {
+	// Identifies the achievement in the save.
+	Name		string
+	Title		string
+	Description	string
+	// Returns true if the record earns it.
+	earned		func(r *record) bool
+}
+
+// Every achievement, in the order they're shown.
+var achievements = []achievement{
+	{"first-catch", "Beginner's luck", "Catch a rabbit.",
+		func(r *record) bool { return r.Caught >= 1 }},
+	{"ten-catches", "Rabbit wrangler", "Catch 10 rabbits.",
+		func(r *record) bool { return r.Caught >= 10 }},
+	{"ten-tags", "Naturalist", "Tag 10 rabbits.",
+		func(r *record) bool { return r.Tagged >= 10 }},
+	{"quick-catch", "Quick hands", "Catch a rabbit within a second of spotting it.",
+		func(r *record) bool { return r.QuickestCatch > 0 && r.QuickestCatch <= time.Second }},
+	{"deep-catch", "Spelunker", "Catch a rabbit 8 directories deep.",
+		func(r *record) bool { return r.DeepestCatch >= 8 }},
+	{"gentle-week", "Gentle giant", "Go a week without killing a rabbit.",
+		func(r *record) bool { return r.SinceKill >= 7 * 24 * time.Hour }},
+	{"streak-3", "Regular", "Go hunting 3 days in a row.",
+		func(r *record) bool { return r.BestStreak >= 3 }},
+	{"streak-7", "Devoted", "Go hunting 7 days in a row.",
+		func(r *record) bool { return r.BestStreak >= 7 }},
+	{"streak-30", "Obsessed", "Go hunting 30 days in a row.",
+		func(r *record) bool { return r.BestStreak >= 30 }},
+}
+
+// Unlocks every achievement the player earned since last time, and
+// returns them.
+func (rs *regionSet) unlockAchievements(now time.Time) []achievement {
+	rec := rs.record(now)
+	unlocked := []achievement{}
+	for _, a := range achievements {
+		if _, ok := rs.player.Unlocked[a.Name]; ok || !a.earned(rec) {
+			continue
+		}
+		rs.player.Unlocked[a.Name] = now
+		unlocked = append(unlocked, a)
+	}
+	return unlocked
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreak(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2016, time.April, d, 12, 0, 0, 0, time.Local)
+	}
+	tests := []struct {
+		hunted	[]int
+		now	int
+		streak	int
+		best	int
+	}{
+		{[]int{}, 1, 0, 0},
+		{[]int{1}, 1, 1, 1},
+		{[]int{1, 1, 1}, 1, 1, 1},
+		{[]int{1, 2, 3}, 3, 3, 3},
+		// Today isn't over, the streak still counts.
+		{[]int{1, 2, 3}, 4, 3, 3},
+		{[]int{1, 2, 3}, 5, 0, 3},
+		{[]int{1, 2, 3, 5, 6}, 6, 2, 3},
+		{[]int{1, 3, 4, 5, 6}, 6, 4, 4},
+	}
+	for _, test := range tests {
+		p := newPlayer()
+		for _, d := range test.hunted {
+			p.hunt(day(d))
+		}
+		if p.streak(day(test.now)) != test.streak || p.BestStreak != test.best {
+			t.Errorf("hunting %v, streak on day %d = %d (best %d), want %d (best %d)",
+				test.hunted, test.now, p.streak(day(test.now)), p.BestStreak,
+				test.streak, test.best)
+		}
+	}
+}
+
+func TestAchievements(t *testing.T) {
+	now := time.Now()
+	rs := regionSet{}
+	rs.choose([]string{"/home/grue", "/home/grue/src"})
+	unlock := func() map[string]bool {
+		names := map[string]bool{}
+		for _, a := range rs.unlockAchievements(now) {
+			names[a.Name] = true
+		}
+		return names
+	}
+
+	if got := unlock(); len(got) != 0 {
+		t.Errorf("a new player unlocked %v", got)
+	}
+
+	// Catches add up over every region.
+	home, src := rs.regions["/home/grue"], rs.regions["/home/grue/src"]
+	home.Stats().recordCatch(3 * time.Second, 2)
+	src.Stats().recordCatch(time.Second / 2, 8)
+	got := unlock()
+	if len(got) != 3 || !got["first-catch"] || !got["quick-catch"] || !got["deep-catch"] {
+		t.Errorf("catching unlocked %v", got)
+	}
+	if got := unlock(); len(got) != 0 {
+		t.Errorf("unlocked twice: %v", got)
+	}
+
+	// A week since starting, but a rabbit was killed yesterday.
+	rs.player.Since = now.Add(-8 * 24 * time.Hour)
+	home.graves = append(home.graves, &grave{Died: now.Add(-24 * time.Hour)})
+	if got := unlock(); got["gentle-week"] {
+		t.Errorf("unlocked gentle-week a day after a kill")
+	}
+	home.graves = home.graves[:0]
+	if got := unlock(); !got["gentle-week"] {
+		t.Errorf("didn't unlock gentle-week after a week without kills: %v", got)
+	}
+	if _, ok := rs.player.Unlocked["gentle-week"]; !ok {
+		t.Errorf("unlock wasn't recorded")
+	}
+}
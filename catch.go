@@ -0,0 +1,165 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// How fast the chance falls with the decay model. At the flee
+	// time it's e^-3, about 5%.
+	CatchDecayRate	= 3.0
+	// How sharp the sigmoid model's drop is, around half the flee
+	// time.
+	CatchSteepness	= 10.0
+
+	// Added to the chance of catching a tagged rabbit. The player
+	// knows its habits.
+	TaggedBonus	= 0.05
+	// Added to the chance of catching a rabbit that was shooed
+	// and got warier.
+	WaryBonus	= -0.05
+	// Added to the chance of catching at the best reputation, and
+	// taken away at the worst.
+	ReputationBonus	= 0.10
+	// Every kill weighs on the reputation as much as this many
+	// catches.
+	KillWeight	= 3
+	// Catches and kills it takes before the reputation settles.
+	ReputationSettle	= 10
+)
+
+// A catch model decides how the chance of catching a rabbit falls
+// after it's spotted. Every mode has one.
+type CatchModel interface {
+	// Returns the name modes refer to it by.
+	Name() string
+	// Returns the chance of catching a rabbit spotted elapsed time
+	// ago, that flees after the flee time. 1 is certain.
+	Chance(elapsed, fleeTime time.Duration) float64
+}
+
+// The model used unless the mode says otherwise.
+const DefaultCatchModel = "linear"
+
+// The names of every catch model, in the order they're shown.
+var catchModelNames = []string{"linear", "decay", "sigmoid"}
+
+// Returns the catch model with the given name. Unknown names get the
+// default.
+func newCatchModel(name string) CatchModel {
+	switch name {
+	case "decay":
+		return decayCatch{}
+	case "sigmoid":
+		return sigmoidCatch{}
+	default:
+		return linearCatch{}
+	}
+}
+
+// The chance falls evenly, to nothing at the flee time.
+type linearCatch struct{}
+
+func (linearCatch) Name() string {
+	return "linear"
+}
+
+func (linearCatch) Chance(elapsed, fleeTime time.Duration) float64 {
+	return 1.0 - float64(elapsed) / float64(fleeTime)
+}
+
+// The chance falls quickly at first, then slower. Only the very
+// quick catch easily.
+type decayCatch struct{}
+
+func (decayCatch) Name() string {
+	return "decay"
+}
+
+func (decayCatch) Chance(elapsed, fleeTime time.Duration) float64 {
+	return math.Exp(-CatchDecayRate * float64(elapsed) / float64(fleeTime))
+}
+
+// The chance stays high for a while, then drops sharply around half
+// the flee time.
+type sigmoidCatch struct{}
+
+func (sigmoidCatch) Name() string {
+	return "sigmoid"
+}
+
+func (sigmoidCatch) Chance(elapsed, fleeTime time.Duration) float64 {
+	x := float64(elapsed) / float64(fleeTime) - 0.5
+	return 1.0 / (1.0 + math.Exp(CatchSteepness * x))
+}
+
+// Something that raises or lowers the chance of a catch.
+type catchModifier struct {
+	// What it comes from, like "tagged".
+	Name	string
+	// Added to the chance.
+	Bonus	float64
+}
+
+// Returns the modifiers on catching any rabbit in the forest, from
+// the mode and the player's reputation.
+func forestModifiers(f Forest) []catchModifier {
+	mods := []catchModifier{}
+	if m := f.Mode(); m.CatchBonus != 0 {
+		mods = append(mods, catchModifier{m.Name + " mode", m.CatchBonus})
+	}
+	if rep := f.Reputation(); rep != 0 {
+		mods = append(mods, catchModifier{"reputation", rep * ReputationBonus})
+	}
+	return mods
+}
+
+// Returns the modifiers on catching the rabbit. Its traits add to
+// the forest's.
+func (r *Rabbit) catchModifiers() []catchModifier {
+	mods := forestModifiers(r.home)
+	if r.tag != "" {
+		mods = append(mods, catchModifier{"tagged", TaggedBonus})
+	}
+	if r.fleeTime < r.home.Mode().FleeTime {
+		mods = append(mods, catchModifier{"wary", WaryBonus})
+	}
+	return mods
+}
+
+// Returns the chance of catching with the model, after the
+// modifiers. Always between 0 and 1. Past the flee time the rabbit
+// is gone and no modifier brings it back.
+func catchChance(model CatchModel, elapsed, fleeTime time.Duration, mods []catchModifier) float64 {
+	if elapsed >= fleeTime {
+		return 0
+	}
+	c := model.Chance(elapsed, fleeTime)
+	for _, m := range mods {
+		c += m.Bonus
+	}
+	return math.Max(0, math.Min(1, c))
+}
+
+// Returns the chance of catching the rabbit right now, from the
+// mode's catch model, the rabbit's own flee time and every modifier.
+// A rabbit that was never spotted can't be caught.
+func (r *Rabbit) CatchChance() float64 {
+	if r.lastSpotted == nil {
+		return 0
+	}
+	fleeTime := r.fleeTime
+	if fleeTime <= 0 {
+		fleeTime = r.home.Mode().FleeTime
+	}
+	return catchChance(r.home.Mode().CatchModel(), r.SinceSpotted(), fleeTime, r.catchModifiers())
+}
+
+// Returns how the player is thought of by rabbits, from -1 for a
+// killer to 1 for a gentle catcher. New players start at 0 and the
+// reputation settles as they play.
+func reputation(caught, killed uint) float64 {
+	good := float64(caught) - KillWeight * float64(killed)
+	return good / (float64(caught) + KillWeight * float64(killed) + ReputationSettle)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCatchModels(t *testing.T) {
+	const flee = 4 * time.Second
+	for _, name := range catchModelNames {
+		m := newCatchModel(name)
+		if m.Name() != name {
+			t.Errorf("model %s is named %s", name, m.Name())
+		}
+		last := 2.0
+		for e := time.Duration(0); e <= flee; e += flee / 8 {
+			c := m.Chance(e, flee)
+			if c < 0 || c > 1 || c >= last {
+				t.Errorf("%s chance after %s = %v, after %v", name, e, c, last)
+			}
+			last = c
+		}
+	}
+	if newCatchModel("nope").Name() != DefaultCatchModel {
+		t.Errorf("unknown model isn't the default")
+	}
+	if c := newCatchModel("sigmoid").Chance(flee / 2, flee); c != 0.5 {
+		t.Errorf("sigmoid chance at half the flee time = %v, want 0.5", c)
+	}
+	if c := newCatchModel("decay").Chance(flee, flee); math.Abs(c - math.Exp(-CatchDecayRate)) > 1e-9 {
+		t.Errorf("decay chance at the flee time = %v", c)
+	}
+}
+
+func TestCatchModifiers(t *testing.T) {
+	linear := newCatchModel("linear")
+	mods := []catchModifier{{"a", 0.3}, {"b", 0.2}}
+	if c := catchChance(linear, 0, time.Second, mods); c != 1 {
+		t.Errorf("chance over 1 = %v, want 1", c)
+	}
+	if c := catchChance(linear, time.Second, time.Second, []catchModifier{{"a", -0.3}}); c != 0 {
+		t.Errorf("chance under 0 = %v, want 0", c)
+	}
+
+	var tf TestForest
+	r := NewRabbit(tf)
+	if len(r.catchModifiers()) != 0 {
+		t.Errorf("plain rabbit modifiers = %v", r.catchModifiers())
+	}
+	r.tag = "fluffy"
+	r.setFleeTime(tf.Mode().FleeTime / 2)
+	if len(r.catchModifiers()) != 2 {
+		t.Errorf("tagged, wary rabbit modifiers = %v", r.catchModifiers())
+	}
+	// The rabbit's own flee time counts, not the mode's.
+	now := time.Now().Add(-r.fleeTime)
+	r.lastSpotted = &now
+	if c := r.CatchChance(); c != 0 {
+		t.Errorf("chance at the rabbit's flee time = %v, want 0", c)
+	}
+}
+
+func TestCatchLongFled(t *testing.T) {
+	f := newDirectoryForest("/home/grue")
+	f.ChangeMode("casual")
+	r := NewRabbit(&f)
+	r.lastMoved = time.Now()
+	r.tag = "fluffy"
+	// It fled a day ago and is wandering again. The casual bonus
+	// doesn't make it easy to catch forever.
+	spotted := time.Now().Add(-24 * time.Hour)
+	r.lastSpotted = &spotted
+	if c := r.CatchChance(); c != 0 {
+		t.Errorf("chance of catching a rabbit that fled long ago = %v, want 0", c)
+	}
+	if r.TryCatch(r.Location(), nil) || r.State() == Caught {
+		t.Errorf("caught a rabbit that fled long ago")
+	}
+}
+
+func TestReputation(t *testing.T) {
+	if reputation(0, 0) != 0 {
+		t.Errorf("new player reputation = %v", reputation(0, 0))
+	}
+	if reputation(100, 0) <= 0.8 || reputation(0, 100) >= -0.8 {
+		t.Errorf("catcher %v, killer %v", reputation(100, 0), reputation(0, 100))
+	}
+	if reputation(3, 1) != 0 {
+		t.Errorf("a kill should undo %d catches", KillWeight)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// How long the player has to answer a catch challenge. Answers
+// slower than this still count, just not for speed.
+const ChallengeTime = time.Duration(4) * time.Second
+
+// Words to type in the word challenge.
+var challengeWords = []string{
+	"carrot", "burrow", "thicket", "clover", "warren", "meadow",
+	"bramble", "whisker", "hollow", "lettuce", "thumper", "hazel",
+}
+
+// Keys pressed in the key challenge, the home row.
+const challengeKeys = "asdfjkl"
+
+// How many keys are pressed in the key challenge.
+const challengeLength = 5
+
+// How the player did at a catch challenge.
+type catchScore struct {
+	// How much of the answer was right, 0 to 1.
+	Accuracy	float64
+	// How much of the challenge time was left, 0 to 1.
+	Speed		float64
+	// When the challenge was shown. The rabbit is judged as of
+	// then, typing doesn't give it time to flee.
+	Shown		time.Time
+}
+
+// Returns how skilled the catch was, 0 to 1. A perfect answer given
+// instantly is 1.
+func (s *catchScore) skill() float64 {
+	return s.Accuracy * s.Speed
+}
+
+// Returns the chance of catching a rabbit after the challenge. A
+// skill of a half leaves the chance as it was, a perfect answer
+// raises it by half and a miss halves it.
+func (s *catchScore) apply(chance float64) float64 {
+	return chance * (0.5 + s.skill())
+}
+
+// Returns what the player has to type, either a word or a sequence
+// of keys.
+func newChallenge() string {
+	if chance(0.5) {
+		return challengeWords[randRange(0, uint(len(challengeWords) - 1))]
+	}
+	keys := make([]byte, challengeLength)
+	for i := range keys {
+		keys[i] = challengeKeys[randRange(0, uint(len(challengeKeys) - 1))]
+	}
+	return string(keys)
+}
+
+// Scores an answer to a challenge given after the time taken.
+func scoreChallenge(want, answer string, taken time.Duration) *catchScore {
+	s := &catchScore{}
+	longest := len(want)
+	if len(answer) > longest {
+		longest = len(answer)
+	}
+	if longest > 0 {
+		s.Accuracy = 1 - float64(editDistance(want, answer)) / float64(longest)
+	}
+	if taken < ChallengeTime {
+		s.Speed = 1 - float64(taken) / float64(ChallengeTime)
+	}
+	return s
+}
+
+// Returns how many letters have to be added, removed or changed to
+// turn one string into the other.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b) + 1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b) + 1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i - 1] == b[j - 1] {
+				cost = 0
+			}
+			cur[j] = prev[j - 1] + cost
+			if prev[j] + 1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j - 1] + 1 < cur[j] {
+				cur[j] = cur[j - 1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// Shows the player a challenge and scores their answer. Returns nil
+// if nothing could be read, the catch is then left to chance.
+func playCatchGame(in io.Reader, out io.Writer) *catchScore {
+	want := newChallenge()
+	fmt.Fprintf(out, "Quick! Type %s: ", want)
+	shown := time.Now()
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return nil
+	}
+	s := scoreChallenge(want, strings.TrimSpace(answer), time.Now().Sub(shown))
+	s.Shown = shown
+	return s
+}
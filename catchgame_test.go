@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b	string
+		want	int
+	}{
+		{"", "", 0},
+		{"carrot", "carrot", 0},
+		{"carrot", "carot", 1},
+		{"carrot", "parrot", 1},
+		{"asdf", "fdsa", 4},
+		{"", "hazel", 5},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestScoreChallenge(t *testing.T) {
+	s := scoreChallenge("carrot", "carrot", 0)
+	if s.skill() != 1 || s.apply(0.5) != 0.75 {
+		t.Errorf("perfect answer skill = %v, chance %v", s.skill(), s.apply(0.5))
+	}
+	s = scoreChallenge("carrot", "carrot", ChallengeTime / 2)
+	if s.apply(0.5) != 0.5 {
+		t.Errorf("answer in half the time, chance = %v, want 0.5", s.apply(0.5))
+	}
+	s = scoreChallenge("carrot", "carrot", 2 * ChallengeTime)
+	if s.Speed != 0 || s.apply(0.5) != 0.25 {
+		t.Errorf("slow answer speed = %v, chance %v", s.Speed, s.apply(0.5))
+	}
+	s = scoreChallenge("hazel", "", 0)
+	if s.Accuracy != 0 {
+		t.Errorf("no answer accuracy = %v, want 0", s.Accuracy)
+	}
+}
+
+func TestPlayCatchGame(t *testing.T) {
+	var out strings.Builder
+	if playCatchGame(strings.NewReader(""), &out) != nil {
+		t.Errorf("nothing typed, still scored")
+	}
+	out.Reset()
+	s := playCatchGame(strings.NewReader("carrot\n"), &out)
+	if s == nil || !strings.HasPrefix(out.String(), "Quick! Type ") {
+		t.Fatalf("answer typed, not scored (%q)", out.String())
+	}
+	want := strings.TrimSuffix(strings.TrimPrefix(out.String(), "Quick! Type "), ": ")
+	if s.Accuracy != scoreChallenge(want, "carrot", 0).Accuracy {
+		t.Errorf("accuracy for %q = %v", want, s.Accuracy)
+	}
+}
+
+func TestCatchScore(t *testing.T) {
+	var tf TestForest
+	r := NewRabbit(tf)
+	r.lastMoved = time.Now()
+	rMachine.Perform(&r, Spot)
+	// A perfect answer makes catching a rabbit just spotted
+	// certain.
+	if !r.TryCatch(r.Location(), scoreChallenge("hazel", "hazel", 0)) || r.State() != Caught {
+		t.Errorf("perfect catch of a rabbit just spotted failed (%v)", r.State())
+	}
+}
+
+func TestCatchShown(t *testing.T) {
+	var tf TestForest
+	r := NewRabbit(tf)
+	r.lastMoved = time.Now()
+	rMachine.Perform(&r, Spot)
+	r.setFleeTime(2 * time.Second)
+	// Spotted long enough ago to have fled, but the challenge was
+	// shown right away. The time spent typing doesn't count.
+	spotted := time.Now().Add(-3 * time.Second)
+	r.lastSpotted = &spotted
+	s := scoreChallenge("hazel", "hazel", 0)
+	s.Shown = spotted
+	if !r.TryCatch(r.Location(), s) || r.State() != Caught {
+		t.Errorf("perfect catch shown as the rabbit was spotted failed (%v)", r.State())
+	}
+
+	r = NewRabbit(tf)
+	r.lastMoved = time.Now()
+	rMachine.Perform(&r, Spot)
+	r.setFleeTime(2 * time.Second)
+	r.lastSpotted = &spotted
+	s.Shown = time.Time{}
+	if r.TryCatch(r.Location(), s) || r.State() == Caught {
+		t.Errorf("caught a rabbit that fled before the challenge was shown")
+	}
+}
+
+func TestCatchUnspotted(t *testing.T) {
+	var tf TestForest
+	r := NewRabbit(tf)
+	r.lastMoved = time.Now()
+	if r.CatchChance() != 0 {
+		t.Errorf("chance of catching an unspotted rabbit = %v", r.CatchChance())
+	}
+	if r.TryCatch(r.Location(), scoreChallenge("hazel", "hazel", 0)) || r.State() == Caught {
+		t.Errorf("caught a rabbit that was never spotted")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Something the watcher saw happen to a directory.
+type fsEvent struct {
+	// When it happened.
+	Time		time.Time
+	// The directory it happened to.
+	Location	string
+	// What happened, "deleted" or "moved". Or "removed" when
+	// it's removed with rabbit rm.
+	Cause		string
+}
+
+// Returns the file events are queued in for a save file.
+func eventsFile(savefile string) string {
+	return savefile + ".events"
+}
+
+// Adds an event to the end of the queue. The queue is locked while
+// it's written, so it isn't taken halfway.
+func queueEvent(filename string, e fsEvent) error {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := lockFile(file); err != nil {
+		return err
+	}
+
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(bs, '\n'))
+	return err
+}
+
+// Takes every event from the queue, oldest first. The queue is
+// locked while it's read and emptied, so events the watcher adds
+// meanwhile wait for the next take.
+func takeEvents(filename string) []fsEvent {
+	file, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	if lockFile(file) != nil {
+		return nil
+	}
+
+	events := []fsEvent{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e fsEvent
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			events = append(events, e)
+		}
+	}
+	file.Truncate(0)
+	return events
+}
+
+// Returns every directory the watcher should keep an eye on. That's
+// where every rabbit is, and every directory above them up to their
+// root, since moving any of those moves the rabbit too.
+func watchedLocations(rs *regionSet) []string {
+	seen := map[string]bool{}
+	locs := []string{}
+	for root, df := range rs.regions {
+		for loc := range df.rabbits {
+			for l := loc; pathWithin(root, l) && !seen[l]; l = ascend(l) {
+				seen[l] = true
+				locs = append(locs, l)
+				if l == root {
+					break
+				}
+			}
+		}
+	}
+	return locs
+}
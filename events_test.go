@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rabbit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := eventsFile(filepath.Join(dir, "save"))
+
+	if es := takeEvents(filename); len(es) != 0 {
+		t.Errorf("took %v from no queue", es)
+	}
+
+	now := time.Now().Round(0)
+	queued := []fsEvent{
+		{now, "/home/grue/src", "deleted"},
+		{now.Add(time.Second), "/home/grue/data", "moved"},
+	}
+	for _, e := range queued {
+		if err := queueEvent(filename, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	taken := takeEvents(filename)
+	if len(taken) != len(queued) {
+		t.Fatalf("took %v, want %v", taken, queued)
+	}
+	for i := range taken {
+		if !taken[i].Time.Equal(queued[i].Time) || taken[i].Location != queued[i].Location ||
+			taken[i].Cause != queued[i].Cause {
+			t.Errorf("event %d = %+v, want %+v", i, taken[i], queued[i])
+		}
+	}
+
+	// The queue is empty once taken.
+	if fi, err := os.Stat(filename); err != nil || fi.Size() != 0 {
+		t.Errorf("queue isn't empty after taking events")
+	}
+	if es := takeEvents(filename); len(es) != 0 {
+		t.Errorf("took %v twice", es)
+	}
+
+	// The watcher waits while the queue is taken.
+	file, _ := os.OpenFile(filename, os.O_RDWR, 0644)
+	lockFile(file)
+	queued2 := make(chan error)
+	go func() {
+		queued2 <- queueEvent(filename, fsEvent{now, "/home/grue/music", "deleted"})
+	}()
+	select {
+	case <-queued2:
+		t.Errorf("event queued while the queue was locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	file.Close()
+	if err := <-queued2; err != nil {
+		t.Fatal(err)
+	}
+	if es := takeEvents(filename); len(es) != 1 || es[0].Location != "/home/grue/music" {
+		t.Errorf("took %v after waiting for the lock", es)
+	}
+
+	// Events queued after a take go in the emptied queue.
+	queueEvent(filename, fsEvent{now, "/home/grue/tmp", "deleted"})
+	if es := takeEvents(filename); len(es) != 1 || es[0].Location != "/home/grue/tmp" {
+		t.Errorf("took %v from a fresh queue", es)
+	}
+}
+
+func TestWatchedLocations(t *testing.T) {
+	root := "/home/grue"
+	f := newDirectoryForest(root)
+	for _, loc := range []string{"/home/grue/src/rabbit", "/home/grue/src", "/home/grue/data"} {
+		r := NewRabbit(&f)
+		f.rabbits[loc] = &r
+	}
+	other := newDirectoryForest("/srv")
+	r := NewRabbit(&other)
+	other.rabbits["/srv/www"] = &r
+	rs := &regionSet{regions: map[string]*directoryForest{root: &f, "/srv": &other}}
+
+	locs := watchedLocations(rs)
+	sort.Strings(locs)
+	want := []string{"/home/grue", "/home/grue/data", "/home/grue/src", "/home/grue/src/rabbit", "/srv", "/srv/www"}
+	if fmt.Sprint(locs) != fmt.Sprint(want) {
+		t.Errorf("watched %v, want %v", locs, want)
+	}
+}
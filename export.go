@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How often the daemon rewrites the textfile when no -every is given.
+const DefaultExportTime = time.Minute
+
+// One number about the forests, for dashboards. Labels that don't
+// apply are left empty.
+type metric struct {
+	Name	string
+	Help	string	`json:"-"`
+	// "counter" or "gauge".
+	Type	string	`json:"-"`
+	Root	string	`json:",omitempty"`
+	Mode	string	`json:",omitempty"`
+	Cause	string	`json:",omitempty"`
+	Value	float64
+}
+
+const killedHelp = "Rabbits killed, by cause of death."
+
+// Returns the numbers about every region, sorted by name and then
+// labels so exports don't shuffle between runs.
+func metrics(rs *regionSet) []metric {
+	ms := []metric{}
+	for root, df := range rs.regions {
+		for name, s := range df.stats {
+			for _, c := range []struct {
+				name, help	string
+				value		uint
+			}{
+				{"rabbit_spotted_total", "Rabbits spotted.", s.Spotted},
+				{"rabbit_caught_total", "Rabbits caught.", s.Caught},
+				{"rabbit_tagged_total", "Rabbits tagged.", s.Tagged},
+			} {
+				ms = append(ms, metric{c.name, c.help, "counter", root, name, "", float64(c.value)})
+			}
+
+			// Kills from before causes were counted have none.
+			unknown := s.Killed
+			for cause, n := range s.KilledBy {
+				ms = append(ms, metric{"rabbit_killed_total", killedHelp, "counter", root, name, cause, float64(n)})
+				unknown -= n
+			}
+			if unknown > 0 {
+				ms = append(ms, metric{"rabbit_killed_total", killedHelp, "counter", root, name, "unknown", float64(unknown)})
+			}
+		}
+
+		tagged := 0
+		for _, r := range df.rabbits {
+			if r.Tag() != "" {
+				tagged++
+			}
+		}
+		ms = append(ms,
+			metric{"rabbit_population", "Rabbits alive.", "gauge", root, df.mode, "", float64(len(df.rabbits))},
+			metric{"rabbit_tagged_alive", "Tagged rabbits alive.", "gauge", root, df.mode, "", float64(tagged)},
+			metric{"rabbit_tracks", "Tracks that haven't faded.", "gauge", root, df.mode, "", float64(df.activeTracks())},
+		)
+	}
+
+	sort.Slice(ms, func(i, j int) bool {
+		a, b := ms[i], ms[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Root != b.Root {
+			return a.Root < b.Root
+		}
+		if a.Mode != b.Mode {
+			return a.Mode < b.Mode
+		}
+		return a.Cause < b.Cause
+	})
+	return ms
+}
+
+// Returns how many tracks haven't faded yet.
+func (f *directoryForest) activeTracks() int {
+	n := 0
+	for _, tl := range f.tracks {
+		for _, t := range tl {
+			if time.Now().Sub(t.Timestamp) < f.fadeTime(t) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// Writes the metrics as csv, prom (Prometheus' text format) or json.
+func writeMetrics(w io.Writer, format string, ms []metric) error {
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"metric", "root", "mode", "cause", "value"})
+		for _, m := range ms {
+			cw.Write([]string{m.Name, m.Root, m.Mode, m.Cause,
+				strconv.FormatFloat(m.Value, 'f', -1, 64)})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "prom":
+		last := ""
+		for _, m := range ms {
+			if m.Name != last {
+				fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.Name, m.Help, m.Name, m.Type)
+				last = m.Name
+			}
+			labels := []string{}
+			for _, l := range [][2]string{{"root", m.Root}, {"mode", m.Mode}, {"cause", m.Cause}} {
+				if l[1] != "" {
+					labels = append(labels, fmt.Sprintf("%s=\"%s\"", l[0], promEscaper.Replace(l[1])))
+				}
+			}
+			_, err := fmt.Fprintf(w, "%s{%s} %s\n", m.Name, strings.Join(labels, ","),
+				strconv.FormatFloat(m.Value, 'f', -1, 64))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		bs, err := json.MarshalIndent(ms, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(bs, '\n'))
+		return err
+	}
+	return fmt.Errorf("can't export as %s, only csv, prom or json", format)
+}
+
+// Escapes label values in Prometheus' text format.
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Writes the metrics of the save to a Prometheus textfile. The file
+// is written aside and renamed over, so a scrape never sees half of
+// it.
+func writeTextfile(savefile, textfile string) error {
+	// The save may be half written, better luck next time.
+	rs, err := readRegions(savefile)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	if err := writeMetrics(&b, "prom", metrics(rs)); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(textfile), ".rabbit")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	os.Chmod(tmp.Name(), 0644)
+	return os.Rename(tmp.Name(), textfile)
+}
+
+// Rewrites the textfile every so often. Runs until killed.
+func exportEvery(savefile, textfile string, every time.Duration) {
+	for {
+		if err := writeTextfile(savefile, textfile); err != nil {
+			fmt.Fprintf(os.Stderr, "rabbit: %v\n", err)
+		}
+		time.Sleep(every)
+	}
+}
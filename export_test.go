@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	ms := []metric{
+		{"rabbit_caught_total", "Rabbits caught.", "counter", "/home/grue", "normal", "", 3},
+		{"rabbit_killed_total", "Rabbits killed.", "counter", `/home/"grue"`, "", "deleted", 2},
+		{"rabbit_killed_total", "Rabbits killed.", "counter", `/home/"grue"`, "", "moved away", 1},
+	}
+
+	var prom strings.Builder
+	if err := writeMetrics(&prom, "prom", ms); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP rabbit_caught_total Rabbits caught.
+# TYPE rabbit_caught_total counter
+rabbit_caught_total{root="/home/grue",mode="normal"} 3
+# HELP rabbit_killed_total Rabbits killed.
+# TYPE rabbit_killed_total counter
+rabbit_killed_total{root="/home/\"grue\"",cause="deleted"} 2
+rabbit_killed_total{root="/home/\"grue\"",cause="moved away"} 1
+`
+	if prom.String() != want {
+		t.Errorf("prom export =\n%s\nwant\n%s", prom.String(), want)
+	}
+
+	var csv strings.Builder
+	if err := writeMetrics(&csv, "csv", ms[:1]); err != nil {
+		t.Fatal(err)
+	}
+	want = "metric,root,mode,cause,value\nrabbit_caught_total,/home/grue,normal,,3\n"
+	if csv.String() != want {
+		t.Errorf("csv export = %q, want %q", csv.String(), want)
+	}
+
+	if err := writeMetrics(&csv, "xml", ms); err == nil {
+		t.Errorf("xml export didn't fail")
+	}
+}
+
+func TestMetricsKills(t *testing.T) {
+	f := newDirectoryForest("/home/grue")
+	rs := &regionSet{regions: map[string]*directoryForest{f.root: &f}}
+	for i := 0; i < MaxGraves + 20; i++ {
+		r := NewRabbit(&f)
+		f.recordKill(&r)
+	}
+	// Kills from an old save have no cause.
+	f.Stats().Killed += 3
+
+	kills := map[string]float64{}
+	for _, m := range metrics(rs) {
+		if m.Name == "rabbit_killed_total" {
+			kills[m.Cause] += m.Value
+		}
+	}
+	if kills[CauseDeleted] != MaxGraves + 20 {
+		t.Errorf("%v rabbits killed by deletion, want %d", kills[CauseDeleted], MaxGraves + 20)
+	}
+	if kills["unknown"] != 3 {
+		t.Errorf("%v rabbits killed by unknown causes, want 3", kills["unknown"])
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rabbit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savefile := filepath.Join(dir, "save")
+	textfile := filepath.Join(dir, "rabbit.prom")
+
+	f := newDirectoryForest(dir)
+	saveRegions(savefile, &regionSet{regions: map[string]*directoryForest{dir: &f}})
+	if err := writeTextfile(savefile, textfile); err != nil {
+		t.Fatal(err)
+	}
+	written, _ := ioutil.ReadFile(textfile)
+	if !strings.Contains(string(written), "rabbit_population") {
+		t.Errorf("textfile has no population:\n%s", written)
+	}
+
+	// Half a save is an error, and the last textfile stays.
+	bs, _ := ioutil.ReadFile(savefile)
+	ioutil.WriteFile(savefile, bs[:len(bs) / 2], 0644)
+	if err := writeTextfile(savefile, textfile); err == nil {
+		t.Errorf("writing the textfile from half a save didn't fail")
+	}
+	if bs, _ := ioutil.ReadFile(textfile); string(bs) != string(written) {
+		t.Errorf("textfile changed after a failed write")
+	}
+}
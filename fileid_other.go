@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// Returns the device and inode of a file. Windows doesn't have
+// them, so ok is always false.
+func fileID(fi os.FileInfo) (dev, ino uint64, ok bool) {
+	return 0, 0, false
+}
@@ -3,14 +3,13 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 )
 
-// The direction of the tracks indicates where a rabbit went
-// from here.
-type TrackDirection uint
-
 const (
 	// Default value.
 	MinRabbits	= 1
@@ -28,46 +27,113 @@ const (
 	// Chance to move twice instead of once.
 	TwoStepChance	= 0.50
 
+	// The most directories looked through when a rabbit's
+	// directory moved.
+	MaxMoveSearch	= 20000
+
+	// The most faraway locations tried when shooing a rabbit
+	// out of a directory.
+	MaxShooTries	= 100
+
+	// How many of the player's recent locations are remembered.
+	// Fleeing rabbits run away from all of them.
+	TrailLength	= 5
+
+	// Chance to keep descending when looking for a faraway
+	// location. The higher, the deeper rabbits go.
+	DescendChance	= 0.65
+	// Higher chances could walk forever around a symlink loop.
+	MaxDescendChance	= 0.95
+
 	// How long it takes for tracks to fade. Right
 	// now, it's a 1/5 of the time it takes a rabbit
 	// to move.
 	TrackFadeTime	= IdleTime / 5
+	// How long it takes for a fleeing rabbit's panic trail
+	// to fade. Chase it quick!
+	PanicFadeTime	= time.Minute
 )
 
-const (
-	// No tracks.
-	TrackNone TrackDirection = iota
-	// Ascending is going "up" a directory, like cd ..
-	TrackAscending
-	// Descending is going "down" a directory, like cd ./data
-	TrackDescending
-)
-
-type track struct {
-	Timestamp	time.Time
-	Direction	TrackDirection
-}
 
 type directoryForest struct {
+	// The directory the forest grows from. Rabbits never go
+	// above it.
+	root		string
 	// List of rabbits and their locations. Only one
 	// rabbit per location.
 	rabbits		map[string]*Rabbit
-	// Tracks at a given location. Cleared and updated after every move.
-	tracks		map[string]track
-	// Number of rabbits seen.
-	spottedCount	uint
-	// Number of rabbits caught.
-	caughtCount	uint
-	// Number of rabbits killed. :(
-	killedCount	uint
+	// Tracks at a given location, left by every rabbit that
+	// passed through. Faded tracks are removed.
+	tracks		map[string]trackList
+	// Where the player checked lately, most recent first.
+	trail		[]string
+	// The name of the mode being played.
+	mode		string
+	// Stats for every mode played, keyed by mode name.
+	stats		map[string]*modeStats
+	// Every rabbit that died here, oldest first.
+	graves		[]*grave
+	// What happened in each directory, keyed by location.
+	hotspots	map[string]*hotspot
+	// When the player was last in each directory, for the map.
+	visitedAt	map[string]time.Time
+	// Where the player last saw each tagged rabbit, keyed by tag.
+	lastSeen	map[string]string
+	// Directories rabbits are being shooed out of. Faraway
+	// locations aren't inside them. Never saved.
+	keepOut		[]string
+	// The directories below the root, looked through the first
+	// time a rabbit's directory goes missing. Never saved.
+	scanned		*dirScan
 }
 
-func newDirectoryForest() directoryForest {
+func newDirectoryForest(root string) directoryForest {
 	return directoryForest{
-		map[string]*Rabbit{}, map[string]track{}, 0, 0, 0,
+		root, map[string]*Rabbit{}, map[string]trackList{}, []string{},
+		DefaultMode, map[string]*modeStats{}, []*grave{},
+		map[string]*hotspot{}, map[string]time.Time{}, map[string]string{}, nil, nil,
 	}
 }
 
+// Returns the mode being played.
+func (f *directoryForest) Mode() *Mode {
+	m := lookupMode(f.mode)
+	if m == nil {
+		return lookupMode(DefaultMode)
+	}
+	return m
+}
+
+// Returns the stats of the mode being played.
+func (f *directoryForest) Stats() *modeStats {
+	s, ok := f.stats[f.Mode().Name]
+	if !ok {
+		s = newModeStats()
+		f.stats[f.Mode().Name] = s
+	}
+	return s
+}
+
+// Switches to another mode. The rabbits scatter and the mode's run
+// starts over, the mode's totals are kept.
+func (f *directoryForest) ChangeMode(name string) bool {
+	m := lookupMode(name)
+	if m == nil {
+		return false
+	}
+	f.mode = m.Name
+	f.rabbits = map[string]*Rabbit{}
+	f.tracks = map[string]trackList{}
+	f.Stats().restart()
+	return true
+}
+
+// Returns true if the current run is over. Nothing happens in the
+// forest until the mode is changed or restarted.
+func (f *directoryForest) RunOver() bool {
+	return f.Stats().isOver(f.Mode())
+}
+
 // For a location to exist, the directory must exist.
 func (f *directoryForest) LocationExists(loc string) bool {
 	fi, err := os.Stat(loc)
@@ -77,119 +143,346 @@ func (f *directoryForest) LocationExists(loc string) bool {
 	return fi.IsDir()
 }
 
-// Returns a location near the passed location. Nearby is
-// found by a small number of random directory changes. Will
-// not be the same directory, unless it has to (can't ascend
-// or descend).
+// Returns a location near the passed location, found with the
+// rabbit's movement strategy. Will not be the same directory,
+// unless it has to (can't move). The rabbit leaves tracks at every
+// location it passes, except where it jumps through a followed
+// symlink into another branch of the tree.
 //
 // XXX: Currently this does not check if a rabbit already
 // exists at the new location. So we just lose rabbits
 // if one encounters another.
-func (f *directoryForest) NearbyLocation(loc string) string {
-	newloc := loc
-
-	steps := 1
-	if chance(TwoStepChance) {
-		steps = 2
-	}
-
-tryagain:
-	added := []string{}
-	for i := 0; i < steps; i++ {
-		// Can't move.
-		if !canAscend(newloc) && !canDescend(newloc) {
-			return newloc
-		} else if chance(AscendChance) {
-			if canAscend(newloc) {
-				newloc = ascend(newloc)
-			} else {
-				newloc = randDescension(newloc)
-			}
-		} else {
-			if canDescend(newloc) {
-				newloc = randDescension(newloc)
-			} else {
-				newloc = ascend(newloc)
-			}
-		}
-
-		added = append(added, newloc)
-	}
-
-	if newloc == loc {
-		// Guaranteed to not be the same because you must
-		// step twice to get to the same destination.
-		steps = 1
-		goto tryagain
+func (f *directoryForest) NearbyLocation(loc string, r *Rabbit) string {
+	added := r.Movement().Walk(f, loc)
+	if len(added) == 0 {
+		return loc
 	}
 
 	pastLoc := loc
 	for _, aloc := range added {
+		dir := TrackNone
 		if isAscension(aloc, pastLoc) {
-			f.tracks[pastLoc] = track{time.Now(), TrackAscending}
+			dir = TrackAscending
 		} else if isDescension(aloc, pastLoc) {
-			f.tracks[pastLoc] = track{time.Now(), TrackDescending}
+			dir = TrackDescending
+		} else if filepath.Dir(aloc) == filepath.Dir(pastLoc) {
+			dir = TrackSideways
 		} else {
-			panic("Rabbit didn't move to nearby location.")
+			// A followed symlink leads somewhere else in
+			// the tree. There's no path to leave tracks on.
+			pastLoc = aloc
+			continue
 		}
+		f.leaveTrack(pastLoc, track{time.Now(), dir, r.ID(), aloc, false})
 		pastLoc = aloc
 	}
 
+	return pastLoc
+}
+
+// Returns where a fleeing rabbit runs to. The rabbit leaves a panic
+// trail along the way.
+func (f *directoryForest) FleeLocation(loc string, r *Rabbit) string {
+	newloc := fleeLocation(f, loc)
+	f.leavePanicTrail(loc, newloc, r)
 	return newloc
+}
+
+// Leaves the rabbit's panic trail from one location to the other.
+func (f *directoryForest) leavePanicTrail(from, to string, r *Rabbit) {
+	pastLoc := from
+	for _, aloc := range treePath(from, to) {
+		dir := TrackDescending
+		if isAscension(aloc, pastLoc) {
+			dir = TrackAscending
+		}
+		f.leaveTrack(pastLoc, track{time.Now(), dir, r.ID(), aloc, true})
+		pastLoc = aloc
+	}
+}
+
+// Returns how long a track takes to fade.
+func (f *directoryForest) fadeTime(t track) time.Duration {
+	fade := f.Mode().TrackFadeTime
+	if t.Panic && PanicFadeTime < fade {
+		return PanicFadeTime
+	}
+	return fade
+}
+
+// Returns the freshest panic trail here. ok is false if there isn't
+// one.
+func (f *directoryForest) PanicTrailHere() (t track, ok bool) {
+	for _, t := range f.TracksHere() {
+		if t.Panic {
+			return t, true
+		}
+	}
+	return track{}, false
+}
 
+// Leaves a track at a location.
+func (f *directoryForest) leaveTrack(loc string, t track) {
+	f.tracks[loc] = f.tracks[loc].add(t)
+}
+
+// The parent directory, unless it's above the root.
+func (f *directoryForest) Parent(loc string) string {
+	if !canAscend(f.root, loc) {
+		return ""
+	}
+	return ascend(loc)
+}
+
+// The directories a rabbit may enter from here.
+func (f *directoryForest) Children(loc string) []string {
+	return listDirs(f.root, loc)
+}
+
+// The number of cd's it takes to get from one directory to the
+// other, going up to the deepest directory they share.
+func (f *directoryForest) Distance(from, to string) int {
+	fparts := pathParts(from)
+	tparts := pathParts(to)
+	shared := 0
+	for shared < len(fparts) && shared < len(tparts) &&
+			fparts[shared] == tparts[shared] {
+		shared++
+	}
+	if shared == 0 {
+		return -1
+	}
+	return len(fparts) + len(tparts) - 2 * shared
 }
 
 // A random faraway location. Rabbits typically start here
 // and run here when they're fleeing. Faraway locations don't
-// add tracks.
+// add tracks. The location is found by walking down from the
+// root, carrying on at each directory with the root's descend
+// chance, so every directory in the tree can be reached, deep
+// ones just less often. Only directories the rules allow are
+// picked.
 func (f *directoryForest) FarawayLocation(loc string) string {
-	newloc := baseLocation()
-	triedagain := false
+	descend := rulesFor(f.root).descendChance
 
-	steps := 1
-	if chance(TwoStepChance) {
-		steps = 2
+	newloc := f.randomWalk(descend)
+	for tries := 1; newloc == loc && tries < 3; tries++ {
+		newloc = f.randomWalk(descend)
 	}
+	for tries := 1; f.keptOut(newloc) && tries < MaxShooTries; tries++ {
+		newloc = f.randomWalk(descend)
+	}
+	return newloc
+}
 
-tryagain:
-	for i := 0; i < steps; i++ {
-		if canDescend(newloc) {
-			newloc = randDescension(newloc)
+// Returns true if rabbits being shooed can't go to the location,
+// because it's where they're shooed from or another rabbit is
+// there already.
+func (f *directoryForest) keptOut(loc string) bool {
+	if len(f.keepOut) == 0 {
+		return false
+	}
+	for _, dir := range f.keepOut {
+		if pathWithin(dir, loc) {
+			return true
 		}
 	}
+	_, taken := f.rabbits[loc]
+	return taken
+}
+
+// Makes every rabbit inside the directory flee somewhere outside
+// it. Returns how many fled, and how many had nowhere to go. Those
+// are left as they were.
+func (f *directoryForest) Shoo(dir string) (moved, stuck int) {
+	f.keepOut = append(f.keepOut, dir)
+	defer func() {
+		f.keepOut = f.keepOut[:len(f.keepOut) - 1]
+	}()
+
+	for _, r := range f.rabbitsWithin(dir) {
+		from := r.Location()
+		to := fleeLocation(f, from)
+		if f.keptOut(to) || !r.Shoo(to) {
+			stuck++
+			continue
+		}
+		delete(f.rabbits, from)
+		f.leavePanicTrail(from, to, r)
 
-	if newloc == loc && !triedagain {
-		// Invert the steps. We can't get to the same
-		// location with different steps.
-		if steps == 1 {
-			steps = 2
-		} else if steps == 2 {
-			steps = 1
+		// Or it would wander right back.
+		if pathWithin(dir, r.territory) {
+			r.territory = r.Location()
 		}
-		triedagain = true
-		goto tryagain
+		f.rabbits[r.Location()] = r
+		moved++
 	}
+	return
+}
 
-	return newloc
+// Returns the rabbits inside the directory.
+func (f *directoryForest) rabbitsWithin(dir string) []*Rabbit {
+	rabbits := []*Rabbit{}
+	for loc, r := range f.rabbits {
+		if pathWithin(dir, loc) {
+			rabbits = append(rabbits, r)
+		}
+	}
+	return rabbits
+}
+
+// Walks down from the root, taking at least one step when it can,
+// and taking another step with the passed chance.
+func (f *directoryForest) randomWalk(descend float64) string {
+	loc := f.root
+	for canDescend(f.root, loc) {
+		loc = randDescension(f.root, loc)
+		if !chance(descend) {
+			break
+		}
+	}
+	return loc
+}
+
+// The device and inode of the directory, like "2049:1234". They
+// stay the same when the directory is renamed.
+func (f *directoryForest) LocationID(loc string) string {
+	fi, err := os.Stat(loc)
+	if err != nil {
+		return ""
+	}
+	dev, ino, ok := fileID(fi)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", dev, ino)
+}
+
+// A directory found while looking through a root.
+type scannedDir struct {
+	path		string
+	dev		uint64
+}
+
+// The directories below a root, for finding the ones that moved.
+type dirScan struct {
+	// Keyed by location ID.
+	byID		map[string]string
+	// Keyed by name, in the order they were found.
+	byName		map[string][]scannedDir
+}
+
+// Looks through the root, once a run. Only so many directories are
+// looked through, so big trees don't stall. Returns nil if
+// directories have no device and inode here.
+func (f *directoryForest) scan() *dirScan {
+	if f.scanned != nil {
+		return f.scanned
+	}
+	ds := &dirScan{map[string]string{}, map[string][]scannedDir{}}
+	dr := rulesFor(f.root)
+	queue := []string{f.root}
+	for searched := 0; len(queue) > 0 && searched < MaxMoveSearch; searched++ {
+		dir := queue[0]
+		queue = queue[1:]
+
+		files, _ := ioutil.ReadDir(dir)
+		for _, fi := range files {
+			if !fi.IsDir() {
+				continue
+			}
+			path := filepath.Join(dir, fi.Name())
+			d, i, ok := fileID(fi)
+			if !ok {
+				return nil
+			}
+			ds.byID[fmt.Sprintf("%d:%d", d, i)] = path
+			ds.byName[fi.Name()] = append(ds.byName[fi.Name()], scannedDir{path, d})
+			if !dr.ignored(path) {
+				queue = append(queue, path)
+			}
+		}
+	}
+	f.scanned = ds
+	return ds
+}
+
+// Looks through the root for the directory that was at loc. A
+// directory renamed or moved on the same device keeps its inode.
+// One moved from another device can't, so if byName is set the
+// first directory with the same name on a different device is taken
+// instead. Only set it when the directory is known to have moved,
+// else a deleted directory comes back as any other of its name.
+func (f *directoryForest) FindLocation(loc, id string, byName bool) string {
+	var dev, ino uint64
+	if _, err := fmt.Sscanf(id, "%d:%d", &dev, &ino); err != nil {
+		return ""
+	}
+	ds := f.scan()
+	if ds == nil {
+		return ""
+	}
+	// The scan may be out of date by now.
+	if path, ok := ds.byID[id]; ok && f.LocationID(path) == id {
+		return path
+	}
+	if byName {
+		for _, sd := range ds.byName[filepath.Base(loc)] {
+			if sd.dev != dev && f.LocationExists(sd.path) {
+				return sd.path
+			}
+		}
+	}
+	return ""
+}
+
+// How the rabbits here think of the player, from the catches and
+// kills of the run.
+func (f *directoryForest) Reputation() float64 {
+	s := f.Stats()
+	return reputation(s.Run.Caught, s.Run.Killed)
+}
+
+// Where the player checked lately, most recent first.
+func (f *directoryForest) Trail() []string {
+	return f.trail
+}
+
+// Adds a location the player checked to their trail.
+func (f *directoryForest) extendTrail(loc string) {
+	if len(f.trail) > 0 && f.trail[0] == loc {
+		return
+	}
+	f.trail = append([]string{loc}, f.trail...)
+	if len(f.trail) > TrailLength {
+		f.trail = f.trail[:TrailLength]
+	}
 }
 
 // Returns true if a rabbit is here. Only useful for checking
 // before performing an action.
 func (f *directoryForest) IsRabbitHere() bool {
-	loc, _ := os.Getwd()
+	loc := currentLocation()
 	_, ok := f.rabbits[loc]
 	return ok
 }
 
-// Returns whether tracks
-func (f *directoryForest) GetTracksHere() (bool, TrackDirection) {
-	loc, _ := os.Getwd()
-	t, ok := f.tracks[loc]
-	if ok {
-		return true, t.Direction
-	} else {
-		return false, TrackNone
+// Returns the tracks here, freshest first.
+func (f *directoryForest) TracksHere() []track {
+	loc := currentLocation()
+	tl := append(trackList{}, f.tracks[loc]...)
+	tl.sort()
+	return tl
+}
+
+// Returns the rabbit with the ID, if it's still in the forest.
+func (f *directoryForest) rabbitByID(id string) *Rabbit {
+	for _, r := range f.rabbits {
+		if r.ID() == id {
+			return r
+		}
 	}
+	return nil
 }
 
 // Anytime a location is entered, a check is performed. This
@@ -198,8 +491,18 @@ func (f *directoryForest) GetTracksHere() (bool, TrackDirection) {
 func (f *directoryForest) PerformCheck() (spotted *Rabbit) {
 	spotted = nil
 
+	// A root that went missing, like an unmounted disk, takes
+	// every rabbit with it. They're left alone until it's back.
+	if f.RunOver() || !f.LocationExists(f.root) {
+		return
+	}
+
+	stats := f.Stats()
+
 	// We always check our current directory.
-	loc, _ := os.Getwd()
+	loc := currentLocation()
+	f.extendTrail(loc)
+	f.recordVisit(loc)
 
 	newrabbits := map[string]*Rabbit{}
 
@@ -215,12 +518,14 @@ func (f *directoryForest) PerformCheck() (spotted *Rabbit) {
 				//
 				// XXX: Fix rabbits running into each other?
 				spotted = r
-				f.spottedCount++
+				stats.recordSpot()
+				f.hotspot(r.Location()).Spotted++
+				f.sawTagged(r, r.Location())
 			}
 			newrabbits[r.Location()] = r
 		} else {
 			if r.State() == Dead {
-				f.killedCount++
+				f.recordKill(r)
 			} else if r.State() == Caught {
 				// Update in PerformCatch, otherwise
 				// catching a rabbit score won't
@@ -240,20 +545,61 @@ func (f *directoryForest) PerformCheck() (spotted *Rabbit) {
 	return
 }
 
-// Attempts to catch a rabbit if it's still where we are.
-func (f *directoryForest) PerformCatch() bool {
-	loc, _ := os.Getwd()
+// Counts a rabbit as killed and buries it. :(
+func (f *directoryForest) recordKill(r *Rabbit) *grave {
+	g := f.bury(r)
+	f.Stats().recordKill(f.Mode(), g.Died, g.Cause)
+	f.hotspot(g.Location).Killed++
+	return g
+}
+
+// The watcher saw a directory go away. Rabbits in it follow it if
+// it was only moved, the rest die and are returned.
+func (f *directoryForest) ApplyEvent(e fsEvent) []*Rabbit {
+	killed := []*Rabbit{}
+	for loc, r := range f.rabbits {
+		if !pathWithin(e.Location, loc) || f.LocationExists(loc) {
+			continue
+		}
+		delete(f.rabbits, loc)
+		// Moved along with its directory, the rabbit carries on
+		// as it was.
+		if r.followLocation(e.Cause == "moved") {
+			f.rabbits[r.Location()] = r
+			continue
+		}
+		r.Displace(e.Time, eventCause(e.Cause))
+		if r.IsPlaying() {
+			f.rabbits[r.Location()] = r
+		} else if r.State() == Dead {
+			// The player is told about these right away.
+			f.recordKill(r).Noticed = true
+			killed = append(killed, r)
+		}
+	}
+	return killed
+}
+
+// Attempts to catch a rabbit if it's still where we are. The score
+// of the catch challenge may be nil if there was none.
+func (f *directoryForest) PerformCatch(score *catchScore) bool {
+	loc := currentLocation()
+
+	if f.RunOver() {
+		return false
+	}
 
 	f.fadeTracks()
 
 	rab, ok := f.rabbits[loc]
 	if ok {
 		delete(f.rabbits, rab.Location())
-		succ := rab.TryCatch(loc)
+		succ := rab.TryCatch(loc, score)
 		// We must update the table, else we can run into two rabbits.
 		f.rabbits[rab.Location()] = rab
 		if succ {
-			f.caughtCount++
+			f.Stats().recordCatch(rab.SinceSpotted(), pathDepth(f.root, loc))
+			f.hotspot(loc).Caught++
 		}
 		return succ
 	}
@@ -263,7 +609,11 @@ func (f *directoryForest) PerformCatch() bool {
 
 // Attempts to tag a rabbit if it's still where we are.
 func (f *directoryForest) PerformTag(tag string) bool {
-	loc, _ := os.Getwd()
+	loc := currentLocation()
+
+	if f.RunOver() {
+		return false
+	}
 
 	f.fadeTracks()
 
@@ -273,6 +623,10 @@ func (f *directoryForest) PerformTag(tag string) bool {
 		succ := rab.TryTag(loc, tag)
 		// We must update the table, else we can run into two rabbits.
 		f.rabbits[rab.Location()] = rab
+		if succ {
+			f.sawTagged(rab, loc)
+			f.Stats().recordTag()
+		}
 		return succ
 	}
 
@@ -280,14 +634,24 @@ func (f *directoryForest) PerformTag(tag string) bool {
 }
 
 // Repopulated the forest if under the minimum number of rabbits
-// we want. Otherwise, chance a rabbit will spawn.
+// we want. Otherwise, chance a rabbit will spawn. The numbers come
+// from the mode being played.
 func (f *directoryForest) repopulate() {
-	for len(f.rabbits) < MinRabbits {
+	m := f.Mode()
+
+	// Rabbits spawned in a missing root would only die.
+	if f.RunOver() || !f.LocationExists(f.root) {
+		return
+	}
+
+	// Small forests may not have room for every rabbit, so only
+	// try so many times.
+	for i := 0; len(f.rabbits) < m.MinRabbits && i < m.MinRabbits * 4; i++ {
 		r := NewRabbit(f)
 		f.rabbits[r.Location()] = &r
 	}
 
-	if chance(SpawnChance) {
+	if len(f.rabbits) < m.MaxRabbits && chance(m.SpawnChance) {
 		r := NewRabbit(f)
 		f.rabbits[r.Location()] = &r
 	}
@@ -296,26 +660,38 @@ func (f *directoryForest) repopulate() {
 // Fades the tracks depending on how old they are. Faded
 // tracks are removed.
 func (f *directoryForest) fadeTracks() {
-	list := []string{}
-	for loc, track := range f.tracks {
-		age := time.Now().Sub(track.Timestamp)
-		if age >= TrackFadeTime {
-			list = append(list, loc)
+	for loc, tl := range f.tracks {
+		kept := trackList{}
+		for _, t := range tl {
+			age := time.Now().Sub(t.Timestamp)
+			if age < f.fadeTime(t) {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			delete(f.tracks, loc)
+		} else {
+			f.tracks[loc] = kept
 		}
-	}
-
-	for _, loc := range list {
-		delete(f.tracks, loc)
 	}
 }
 
 // Used for marshalling/unmarshalling.
 type forest struct {
+	Root		string
 	Rabbits		map[string]*Rabbit
-	Tracks		map[string]track
-	SpottedCount	uint
-	CaughtCount	uint
-	KilledCount	uint
+	Tracks		map[string]trackList
+	Trail		[]string
+	Mode		string
+	Stats		map[string]*modeStats
+	Graves		[]*grave	`json:",omitempty"`
+	Hotspots	map[string]*hotspot	`json:",omitempty"`
+	Visited		map[string]time.Time	`json:",omitempty"`
+	LastSeen	map[string]string	`json:",omitempty"`
+	// Saves from before modes existed kept their stats here.
+	SpottedCount	uint	`json:",omitempty"`
+	CaughtCount	uint	`json:",omitempty"`
+	KilledCount	uint	`json:",omitempty"`
 }
 
 // These are implemented because we can't encode private fields.
@@ -325,11 +701,30 @@ func (f *directoryForest) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+	f.root = data.Root
 	f.rabbits = data.Rabbits
 	f.tracks = data.Tracks
-	f.spottedCount = data.SpottedCount
-	f.caughtCount = data.CaughtCount
-	f.killedCount = data.KilledCount
+	f.trail = data.Trail
+	f.mode = data.Mode
+	f.stats = data.Stats
+	f.graves = data.Graves
+	if f.graves == nil {
+		f.graves = []*grave{}
+	}
+	f.hotspots = data.Hotspots
+	f.visitedAt = data.Visited
+	f.lastSeen = data.LastSeen
+	if f.mode == "" {
+		f.mode = DefaultMode
+	}
+	if f.stats == nil {
+		f.stats = map[string]*modeStats{}
+		s := newModeStats()
+		s.Spotted = data.SpottedCount
+		s.Caught = data.CaughtCount
+		s.Killed = data.KilledCount
+		f.stats[DefaultMode] = s
+	}
 
 	// Circular reference. Couldn't marshal their home so
 	// we do it here.
@@ -341,10 +736,15 @@ func (f *directoryForest) UnmarshalJSON(b []byte) error {
 
 func (f *directoryForest) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&forest{
+		Root:		f.root,
 		Rabbits:	f.rabbits,
 		Tracks:		f.tracks,
-		SpottedCount:	f.spottedCount,
-		CaughtCount:	f.caughtCount,
-		KilledCount:	f.killedCount,
+		Trail:		f.trail,
+		Mode:		f.mode,
+		Stats:		f.stats,
+		Graves:		f.graves,
+		Hotspots:	f.hotspots,
+		Visited:	f.visitedAt,
+		LastSeen:	f.lastSeen,
 	})
 }
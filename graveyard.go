@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	// Why rabbits die. The rabbit's directory was deleted, removed
+	// with rabbit rm, or moved somewhere outside the forest.
+	CauseDeleted	= "deleted"
+	CauseRemoved	= "removed"
+	CauseMovedAway	= "moved away"
+
+	// The most graves kept per forest. The oldest are forgotten.
+	MaxGraves	= 100
+)
+
+// Where a dead rabbit lies, and what's known about its death.
+type grave struct {
+	// The ID of the rabbit.
+	Rabbit		string
+	// The rabbit's tag, if it had one.
+	Tag		string	`json:",omitempty"`
+	// The directory it died in.
+	Location	string
+	// About when it died. When its directory went missing if
+	// that's known, otherwise when the death was noticed.
+	Died		time.Time
+	// The probable cause of death.
+	Cause		string
+	// The mode being played.
+	Mode		string
+	// Whether the player has been told about it.
+	Noticed		bool
+}
+
+// Returns the cause of death for an event's cause, "deleted",
+// "removed" or "moved". Rabbits only die from a move out of the
+// forest.
+func eventCause(cause string) string {
+	switch cause {
+	case "moved": return CauseMovedAway
+	case "removed": return CauseRemoved
+	default: return CauseDeleted
+	}
+}
+
+// Buries a dead rabbit, and returns its grave.
+func (f *directoryForest) bury(r *Rabbit) *grave {
+	g := &grave{
+		Rabbit:		r.ID(),
+		Tag:		r.Tag(),
+		Location:	r.lastLocation,
+		Died:		r.displacedAt,
+		Cause:		r.displacedBy,
+		Mode:		f.Mode().Name,
+	}
+	if g.Died.IsZero() {
+		g.Died = time.Now()
+	}
+	if g.Cause == "" {
+		g.Cause = CauseDeleted
+	}
+
+	f.graves = append(f.graves, g)
+	if len(f.graves) > MaxGraves {
+		f.graves = f.graves[len(f.graves) - MaxGraves:]
+	}
+	return g
+}
+
+// Returns the graves the player hasn't been told about, and counts
+// them as told.
+func (f *directoryForest) unnoticedGraves() []*grave {
+	graves := []*grave{}
+	for _, g := range f.graves {
+		if !g.Noticed {
+			g.Noticed = true
+			graves = append(graves, g)
+		}
+	}
+	return graves
+}
+
+// Returns the graves in every region, most recent first.
+func graveyard(rs *regionSet) []*grave {
+	graves := []*grave{}
+	for _, df := range rs.regions {
+		graves = append(graves, df.graves...)
+	}
+	sort.Slice(graves, func(i, j int) bool {
+		return graves[i].Died.After(graves[j].Died)
+	})
+	return graves
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+
+// A directory a command removes or moves.
+type target struct {
+	Location	string
+	// Where it's moved to, "" if it's removed.
+	To		string
+}
+
+// The options of rm and mv that take a value, by their short name.
+// A short one may end a cluster, like -ft dir or -tdir, a long one
+// is given as --opt=val or --opt val.
+var valueOptions = map[byte]string{
+	't': "target-directory",
+	'S': "suffix",
+}
+
+// Splits a command's arguments into its paths, skipping options and
+// their values. The directory the -t option names is returned
+// separately, since mv moves everything into it.
+func commandPaths(args []string) (paths []string, into string) {
+	paths = []string{}
+	flags := true
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case !flags || a == "-" || !strings.HasPrefix(a, "-"):
+			paths = append(paths, a)
+		case a == "--":
+			flags = false
+		case strings.HasPrefix(a, "--"):
+			name, value := a[2:], ""
+			if eq := strings.Index(name, "="); eq >= 0 {
+				name, value = name[:eq], name[eq + 1:]
+			} else if isValueOption(name) && i + 1 < len(args) {
+				i++
+				value = args[i]
+			}
+			if name == valueOptions['t'] {
+				into = value
+			}
+		default:
+			// A cluster of short options. The first that takes
+			// a value takes the rest of the cluster, or the next
+			// argument.
+			for j := 1; j < len(a); j++ {
+				if _, ok := valueOptions[a[j]]; !ok {
+					continue
+				}
+				value := a[j + 1:]
+				if value == "" && i + 1 < len(args) {
+					i++
+					value = args[i]
+				}
+				if a[j] == 't' {
+					into = value
+				}
+				break
+			}
+		}
+	}
+	return paths, into
+}
+
+// Returns true if the long option takes a value.
+func isValueOption(name string) bool {
+	for _, long := range valueOptions {
+		if name == long {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the path of a command argument. The directories above it
+// are resolved, but not the path itself, since rm and mv act on a
+// symlink and not on what it points to.
+func argumentPath(arg string) string {
+	abs, err := filepath.Abs(arg)
+	if err != nil {
+		return filepath.Clean(arg)
+	}
+	return filepath.Join(resolvePath(filepath.Dir(abs)), filepath.Base(abs))
+}
+
+// Returns true if the argument is a real directory, not a symlink
+// to one. Only those can have rabbits in them.
+func isDirectory(path string) bool {
+	fi, err := os.Lstat(path)
+	return err == nil && fi.IsDir()
+}
+
+// Returns the directories rm removes with the arguments.
+func removedBy(args []string) []target {
+	paths, _ := commandPaths(args)
+	targets := []target{}
+	for _, p := range paths {
+		if p := argumentPath(p); isDirectory(p) {
+			targets = append(targets, target{p, ""})
+		}
+	}
+	return targets
+}
+
+// Returns the directories mv moves with the arguments, and where
+// they end up.
+func movedBy(args []string) []target {
+	paths, into := commandPaths(args)
+	if into == "" {
+		if len(paths) < 2 {
+			return nil
+		}
+		into = paths[len(paths) - 1]
+		paths = paths[:len(paths) - 1]
+		// Moving one thing to a name that isn't a directory
+		// renames it.
+		if fi, err := os.Stat(into); len(paths) == 1 && (err != nil || !fi.IsDir()) {
+			if p := argumentPath(paths[0]); isDirectory(p) {
+				return []target{{p, argumentPath(into)}}
+			}
+			return nil
+		}
+	}
+
+	dest := resolvePath(into)
+	targets := []target{}
+	for _, p := range paths {
+		if p := argumentPath(p); isDirectory(p) {
+			targets = append(targets, target{p, filepath.Join(dest, filepath.Base(p))})
+		}
+	}
+	return targets
+}
+
+// Returns the rabbits the targets put in danger. Rabbits only
+// survive a move that keeps them in their own forest.
+func inDanger(rs *regionSet, targets []target) []*Rabbit {
+	rabbits := []*Rabbit{}
+	for root, df := range rs.regions {
+		for loc, r := range df.rabbits {
+			for _, t := range targets {
+				if !pathWithin(t.Location, loc) {
+					continue
+				}
+				if t.To != "" && pathWithin(root, t.To) && rs.regionFor(t.To) == df {
+					continue
+				}
+				rabbits = append(rabbits, r)
+				break
+			}
+		}
+	}
+	return rabbits
+}
+
+// Queues an event for every target with a rabbit in it, so rabbits
+// that die because of the command are known to have died of it.
+// Queued before the command runs, events for directories that are
+// still there afterwards do nothing.
+func logTargets(rs *regionSet, targets []target, cause string) {
+	for _, t := range targets {
+		if hasRabbits(rs, t.Location) {
+			queueEvent(eventsFile(savefile), fsEvent{time.Now(), t.Location, cause})
+		}
+	}
+}
+
+// Returns true if a rabbit is in the directory, in any region.
+func hasRabbits(rs *regionSet, dir string) bool {
+	for _, df := range rs.regions {
+		if len(df.rabbitsWithin(dir)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Shoos the rabbits out of the directories, in every region.
+// Returns how many were moved, and how many had nowhere to go.
+func shooOut(rs *regionSet, dirs []string) (moved, stuck int) {
+	for _, dir := range dirs {
+		for _, df := range rs.regions {
+			m, s := df.Shoo(dir)
+			moved, stuck = moved + m, stuck + s
+		}
+	}
+	return
+}
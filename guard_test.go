@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCommandPaths(t *testing.T) {
+	tests := []struct {
+		args	[]string
+		paths	[]string
+		into	string
+	}{
+		{[]string{"-rf", "build", "dist"}, []string{"build", "dist"}, ""},
+		{[]string{"-r", "--", "-odd", "-"}, []string{"-odd", "-"}, ""},
+		{[]string{"-t", "old", "a", "b"}, []string{"a", "b"}, "old"},
+		{[]string{"--target-directory=old", "a"}, []string{"a"}, "old"},
+		{[]string{"--target-directory", "old", "a", "b"}, []string{"a", "b"}, "old"},
+		{[]string{"-ft", "old", "a"}, []string{"a"}, "old"},
+		{[]string{"-vtold", "a"}, []string{"a"}, "old"},
+		{[]string{"-fi", "a"}, []string{"a"}, ""},
+		{[]string{"-S", ".bak", "a", "b"}, []string{"a", "b"}, ""},
+		{[]string{"-bS.bak", "a", "b"}, []string{"a", "b"}, ""},
+		{[]string{"--suffix", ".bak", "a", "b"}, []string{"a", "b"}, ""},
+		{[]string{"--backup=numbered", "a", "b"}, []string{"a", "b"}, ""},
+		{[]string{}, []string{}, ""},
+	}
+	for _, test := range tests {
+		paths, into := commandPaths(test.args)
+		if fmt.Sprint(paths) != fmt.Sprint(test.paths) || into != test.into {
+			t.Errorf("commandPaths(%v) = %v, %s, want %v, %s",
+				test.args, paths, into, test.paths, test.into)
+		}
+	}
+}
+
+func TestCommandTargets(t *testing.T) {
+	root := makeTree(t, 2, 2, 1)
+	defer os.RemoveAll(root)
+	outside := makeTree(t, 0, 0, 0)
+	defer os.RemoveAll(outside)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(root)
+
+	rs := regionSet{}
+	rs.choose([]string{root})
+	df := rs.regions[root]
+	r := NewRabbit(df)
+	r.setLocation(filepath.Join(root, "dir0/dir1"))
+	df.rabbits = map[string]*Rabbit{r.Location(): &r}
+
+	in := func(p string) string {
+		return filepath.Join(root, p)
+	}
+	tests := []struct {
+		cmd	string
+		args	[]string
+		targets	string
+		danger	bool
+	}{
+		// Files don't matter, only directories.
+		{"rm", []string{"-rf", "dir0", "file0"}, fmt.Sprint([]target{{in("dir0"), ""}}), true},
+		{"rm", []string{"-r", "dir1"}, fmt.Sprint([]target{{in("dir1"), ""}}), false},
+		{"mv", []string{"dir0", "dir1"}, fmt.Sprint([]target{{in("dir0"), in("dir1/dir0")}}), false},
+		{"mv", []string{"dir0", "renamed"}, fmt.Sprint([]target{{in("dir0"), in("renamed")}}), false},
+		{"mv", []string{"-t", outside, "dir0/dir1", "dir1"}, fmt.Sprint([]target{
+			{in("dir0/dir1"), filepath.Join(outside, "dir1")},
+			{in("dir1"), filepath.Join(outside, "dir1")},
+		}), true},
+		{"mv", []string{"dir0", outside}, fmt.Sprint([]target{{in("dir0"), filepath.Join(outside, "dir0")}}), true},
+		{"mv", []string{"-ft", outside, "dir0"}, fmt.Sprint([]target{{in("dir0"), filepath.Join(outside, "dir0")}}), true},
+		{"mv", []string{"--target-directory", outside, "dir1"}, fmt.Sprint([]target{{in("dir1"), filepath.Join(outside, "dir1")}}), false},
+	}
+	for _, test := range tests {
+		var targets []target
+		if test.cmd == "rm" {
+			targets = removedBy(test.args)
+		} else {
+			targets = movedBy(test.args)
+		}
+		if fmt.Sprint(targets) != test.targets {
+			t.Errorf("%s %v targets %v, want %s", test.cmd, test.args, targets, test.targets)
+		}
+		if danger := len(inDanger(&rs, targets)) > 0; danger != test.danger {
+			t.Errorf("%s %v puts the rabbit in danger = %v, want %v",
+				test.cmd, test.args, danger, test.danger)
+		}
+	}
+}
+
+func TestLogTargets(t *testing.T) {
+	root := makeTree(t, 2, 2, 0)
+	defer os.RemoveAll(root)
+	saved := savefile
+	defer func() { savefile = saved }()
+	savefile = filepath.Join(root, "save")
+
+	rs := regionSet{}
+	rs.choose([]string{root})
+	df := rs.regions[root]
+	r := NewRabbit(df)
+	r.setLocation(filepath.Join(root, "dir0/dir1"))
+	df.rabbits = map[string]*Rabbit{r.Location(): &r}
+
+	// Only the directory with a rabbit in it is worth an event.
+	logTargets(&rs, []target{{filepath.Join(root, "dir1"), ""}, {filepath.Join(root, "dir0"), ""}}, "removed")
+	es := takeEvents(eventsFile(savefile))
+	if len(es) != 1 || es[0].Location != filepath.Join(root, "dir0") {
+		t.Errorf("queued %v, want only %s", es, filepath.Join(root, "dir0"))
+	}
+}
+
+func TestShoo(t *testing.T) {
+	root := makeTree(t, 2, 3, 0)
+	defer os.RemoveAll(root)
+	f := newDirectoryForest(root)
+	dir := filepath.Join(root, "dir0")
+
+	for _, loc := range []string{"dir0", "dir0/dir1", "dir0/dir1/dir0", "dir1"} {
+		r := NewRabbit(&f)
+		r.setLocation(filepath.Join(root, loc))
+		r.territory = r.Location()
+		f.rabbits[r.Location()] = &r
+	}
+
+	moved, stuck := f.Shoo(dir)
+	if moved != 3 || stuck != 0 {
+		t.Errorf("Shoo(%s) = %d, %d, want 3, 0", dir, moved, stuck)
+	}
+	if len(f.rabbits) != 4 {
+		t.Errorf("rabbits were lost, %d left", len(f.rabbits))
+	}
+	for loc, r := range f.rabbits {
+		if pathWithin(dir, loc) || pathWithin(dir, r.territory) || loc != r.Location() {
+			t.Errorf("rabbit wasn't shooed out of %s (%s)", dir, r.Location())
+		}
+		if loc == filepath.Join(root, "dir1") {
+			continue
+		}
+		if r.State() != Fleeing || r.fleeTime >= FleeTime {
+			t.Errorf("shooed rabbit isn't fleeing warily (%v, %s)", r.State(), r.fleeTime)
+		}
+	}
+	if _, ok := f.tracks[dir]; !ok {
+		t.Errorf("shooed rabbits left no trail")
+	}
+	if len(f.keepOut) != 0 {
+		t.Errorf("rabbits are still kept out of %v", f.keepOut)
+	}
+
+	// There's nowhere outside the root to go. Stuck rabbits are
+	// left as they were, and leave no trail.
+	type before struct {
+		state		RabbitState
+		fleeTime	time.Duration
+	}
+	was := map[string]before{}
+	for loc, r := range f.rabbits {
+		was[loc] = before{r.state, r.fleeTime}
+	}
+	f.tracks = map[string]trackList{}
+	if moved, stuck := f.Shoo(root); moved != 0 || stuck != 4 {
+		t.Errorf("Shoo(%s) = %d, %d, want 0, 4", root, moved, stuck)
+	}
+	for loc, r := range f.rabbits {
+		if w, ok := was[loc]; !ok || r.state != w.state || r.fleeTime != w.fleeTime {
+			t.Errorf("stuck rabbit in %s changed (%v, %s)", loc, r.State(), r.fleeTime)
+		}
+	}
+	if len(f.tracks) != 0 {
+		t.Errorf("stuck rabbits left tracks in %v", f.tracks)
+	}
+
+	// Only shooing makes a wandering rabbit flee. A failed catch
+	// or a tag leaves it be.
+	r := f.rabbits[filepath.Join(root, "dir1")]
+	r.state = Wandering
+	r.lastMoved = time.Now()
+	r.TryTag(r.Location(), "clover")
+	if r.State() != Wandering {
+		t.Errorf("tagged wandering rabbit is %v, want %v", r.State(), Wandering)
+	}
+
+	// Shooing over and over only makes rabbits so wary.
+	for i := 0; i < 20; i++ {
+		r.Shoo(r.Location())
+	}
+	if r.fleeTime != MinFleeTime {
+		t.Errorf("flee time = %s, want %s", r.fleeTime, MinFleeTime)
+	}
+}
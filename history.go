@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The most days of history kept. Older days are forgotten.
+	MaxHistoryDays	= 400
+	// How far back history goes when no --since is given.
+	DefaultSince	= 28 * 24 * time.Hour
+)
+
+// How days are written in the history.
+const dayFormat = "2006-01-02"
+
+// What happened on one day, or over a longer period.
+type dayStats struct {
+	Spotted		uint
+	Caught		uint
+	Tagged		uint
+	Killed		uint
+	// The time from spotting to catching, summed over every
+	// rabbit caught.
+	CatchTime	time.Duration
+}
+
+// Adds up another day's stats.
+func (d *dayStats) add(o *dayStats) {
+	d.Spotted += o.Spotted
+	d.Caught += o.Caught
+	d.Tagged += o.Tagged
+	d.Killed += o.Killed
+	d.CatchTime += o.CatchTime
+}
+
+// Returns the average time from spotting to catching, zero if
+// nothing was caught.
+func (d *dayStats) catchLatency() time.Duration {
+	if d.Caught == 0 {
+		return 0
+	}
+	return d.CatchTime / time.Duration(d.Caught)
+}
+
+// Returns the stats of the day the time is on, starting it if it's
+// a new day. Starting a day forgets the days too old to keep.
+func (s *modeStats) day(t time.Time) *dayStats {
+	if s.Daily == nil {
+		s.Daily = map[string]*dayStats{}
+	}
+	key := t.Format(dayFormat)
+	d, ok := s.Daily[key]
+	if !ok {
+		d = &dayStats{}
+		s.Daily[key] = d
+		oldest := t.AddDate(0, 0, -MaxHistoryDays).Format(dayFormat)
+		for k := range s.Daily {
+			if k < oldest {
+				delete(s.Daily, k)
+			}
+		}
+	}
+	return d
+}
+
+// Returns midnight at the start of the day the time is on.
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// Returns midnight at the start of the week the time is in. Weeks
+// start on Monday.
+func startOfWeek(t time.Time) time.Time {
+	return startOfDay(t).AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+}
+
+// A stretch of the history, a day or a week.
+type period struct {
+	Start	time.Time
+	dayStats
+}
+
+// Returns the history from since to now, a period per day, or per
+// week if weekly. Every period is there, even if nothing happened.
+func (s *modeStats) history(since, now time.Time, weekly bool) []period {
+	start, next := startOfDay, func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	if weekly {
+		start, next = startOfWeek, func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	}
+
+	periods := []period{}
+	for t := start(since); !t.After(now); t = next(t) {
+		periods = append(periods, period{Start: t})
+	}
+	if len(periods) == 0 {
+		return periods
+	}
+
+	keys := make([]string, 0, len(s.Daily))
+	for k := range s.Daily {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		t, err := time.ParseInLocation(dayFormat, k, now.Location())
+		if err != nil || t.Before(periods[0].Start) || t.After(now) {
+			continue
+		}
+		i := sort.Search(len(periods), func(i int) bool {
+			return periods[i].Start.After(t)
+		}) - 1
+		periods[i].add(s.Daily[k])
+	}
+	return periods
+}
+
+// Parses how far back to look, like "7d", "2w" or "36h".
+func parseSince(since string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(since, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(since, suffix))
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("bad time %q", since)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(since)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("bad time %q", since)
+	}
+	return d, nil
+}
+
+// The bars of a sparkline, lowest to highest.
+var sparks = []rune("▁▂▃▄▅▆▇█")
+var asciiSparks = []rune("_.-=*#")
+
+// Returns a sparkline of the values, one bar each, scaled to the
+// highest. Nothing at all is the lowest bar.
+func sparkline(values []float64, bars []rune) string {
+	high := 0.0
+	for _, v := range values {
+		high = math.Max(high, v)
+	}
+	line := make([]rune, len(values))
+	for i, v := range values {
+		b := 0
+		if high > 0 {
+			b = int(math.Ceil(v / high * float64(len(bars) - 1)))
+		}
+		line[i] = bars[b]
+	}
+	return string(line)
+}
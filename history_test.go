@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistory(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2016, time.April, d, 12, 0, 0, 0, time.Local)
+	}
+	s := newModeStats()
+	s.day(day(1)).Spotted = 3
+	s.day(day(4)).Caught = 2
+	s.day(day(4)).CatchTime = 3 * time.Second
+	s.day(day(11)).Killed = 1
+
+	daily := s.history(day(3), day(11), false)
+	if len(daily) != 9 {
+		t.Fatalf("days from the 3rd to the 11th = %d, want 9", len(daily))
+	}
+	if daily[0].Spotted != 0 || daily[1].Caught != 2 || daily[8].Killed != 1 {
+		t.Errorf("daily history = %+v", daily)
+	}
+	if daily[1].catchLatency() != 1500 * time.Millisecond {
+		t.Errorf("catch latency = %s, want 1.5s", daily[1].catchLatency())
+	}
+
+	// April 4th 2016 is a Monday.
+	weekly := s.history(day(1), day(11), true)
+	if len(weekly) != 3 {
+		t.Fatalf("weeks = %d, want 3", len(weekly))
+	}
+	if weekly[0].Spotted != 3 || weekly[1].Caught != 2 || weekly[2].Killed != 1 {
+		t.Errorf("weekly history = %+v", weekly)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	tests := []struct {
+		since	string
+		want	time.Duration
+		ok	bool
+	}{
+		{"7d", 7 * 24 * time.Hour, true},
+		{"2w", 14 * 24 * time.Hour, true},
+		{"36h", 36 * time.Hour, true},
+		{"xd", 0, false},
+		{"-1d", 0, false},
+		{"soon", 0, false},
+	}
+	for _, test := range tests {
+		got, err := parseSince(test.since)
+		if (err == nil) != test.ok || got != test.want {
+			t.Errorf("parseSince(%q) = %s, %v", test.since, got, err)
+		}
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	bars := []rune("_.-=*#")
+	if got := sparkline([]float64{0, 1, 5, 10}, bars); got != "_.=#" {
+		t.Errorf("sparkline = %q, want %q", got, "_.=#")
+	}
+	if got := sparkline([]float64{0, 0}, bars); got != "__" {
+		t.Errorf("sparkline of nothing = %q, want %q", got, "__")
+	}
+}
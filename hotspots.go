@@ -0,0 +1,107 @@
+package main
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// What happened in one directory, or everywhere below it.
+type hotspot struct {
+	Spotted		uint	`json:",omitempty"`
+	Caught		uint	`json:",omitempty"`
+	Killed		uint	`json:",omitempty"`
+}
+
+// Adds up another directory's counts.
+func (h *hotspot) add(o *hotspot) {
+	h.Spotted += o.Spotted
+	h.Caught += o.Caught
+	h.Killed += o.Killed
+}
+
+// Returns how much happened, all counts together.
+func (h *hotspot) total() uint {
+	return h.Spotted + h.Caught + h.Killed
+}
+
+// Returns the hotspot of the location, starting it if nothing
+// happened there yet.
+func (f *directoryForest) hotspot(loc string) *hotspot {
+	if f.hotspots == nil {
+		f.hotspots = map[string]*hotspot{}
+	}
+	h, ok := f.hotspots[loc]
+	if !ok {
+		h = &hotspot{}
+		f.hotspots[loc] = h
+	}
+	return h
+}
+
+// A directory and what happened in it.
+type spot struct {
+	Location	string
+	// How many directories below the top of the heatmap it is.
+	Depth		int
+	hotspot
+}
+
+// Returns the directories something happened in, in every region,
+// the most happening first.
+func hotspots(rs *regionSet) []spot {
+	counts := map[string]*hotspot{}
+	for _, df := range rs.regions {
+		for loc, h := range df.hotspots {
+			if counts[loc] == nil {
+				counts[loc] = &hotspot{}
+			}
+			counts[loc].add(h)
+		}
+	}
+
+	spots := []spot{}
+	for loc, h := range counts {
+		spots = append(spots, spot{Location: loc, hotspot: *h})
+	}
+	sort.Slice(spots, func(i, j int) bool {
+		if spots[i].total() != spots[j].total() {
+			return spots[i].total() > spots[j].total()
+		}
+		return spots[i].Location < spots[j].Location
+	})
+	return spots
+}
+
+// Returns the tree of directories inside root that something
+// happened in, a directory before the ones inside it. Every
+// directory counts what happened everywhere below it too.
+func heatTree(spots []spot, root string) []spot {
+	root = filepath.Clean(root)
+	counts := map[string]*hotspot{}
+	for _, s := range spots {
+		if !pathWithin(root, s.Location) {
+			continue
+		}
+		for _, loc := range append([]string{root}, treePath(root, s.Location)...) {
+			if counts[loc] == nil {
+				counts[loc] = &hotspot{}
+			}
+			counts[loc].add(&s.hotspot)
+		}
+	}
+
+	tree := []spot{}
+	for loc, h := range counts {
+		tree = append(tree, spot{loc, pathDepth(root, loc), *h})
+	}
+	sort.Slice(tree, func(i, j int) bool {
+		a, b := pathParts(tree[i].Location), pathParts(tree[j].Location)
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return tree
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHotspots(t *testing.T) {
+	home := newDirectoryForest("/home/grue")
+	work := newDirectoryForest("/work")
+	rs := &regionSet{regions: map[string]*directoryForest{
+		"/home/grue": &home, "/work": &work,
+	}}
+	home.hotspot("/home/grue/src").Spotted = 3
+	home.hotspot("/home/grue/src/rabbit").Caught = 2
+	home.hotspot("/home/grue/docs").Killed = 1
+	home.hotspot("/home/grue2").Spotted = 1
+	work.hotspot("/work/build").Spotted = 4
+
+	spots := hotspots(rs)
+	want := []string{"/work/build", "/home/grue/src", "/home/grue/src/rabbit",
+		"/home/grue/docs", "/home/grue2"}
+	if len(spots) != len(want) {
+		t.Fatalf("hotspots = %+v, want %v", spots, want)
+	}
+	for i, s := range spots {
+		if s.Location != want[i] {
+			t.Errorf("hotspot %d = %s, want %s", i, s.Location, want[i])
+		}
+	}
+
+	tree := heatTree(spots, "/home/grue")
+	wantTree := []struct {
+		loc	string
+		depth	int
+		total	uint
+	}{
+		{"/home/grue", 0, 6},
+		{"/home/grue/docs", 1, 1},
+		{"/home/grue/src", 1, 5},
+		{"/home/grue/src/rabbit", 2, 2},
+	}
+	if len(tree) != len(wantTree) {
+		t.Fatalf("heat tree = %+v", tree)
+	}
+	for i, w := range wantTree {
+		s := tree[i]
+		if s.Location != w.loc || s.Depth != w.depth || s.total() != w.total {
+			t.Errorf("heat tree %d = %s at %d (%d), want %s at %d (%d)", i,
+				s.Location, s.Depth, s.total(), w.loc, w.depth, w.total)
+		}
+	}
+}
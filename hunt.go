@@ -0,0 +1,411 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// How often the hunting screen is redrawn, so the time left
+	// to catch a rabbit counts down.
+	HuntRefreshTime	= time.Duration(200) * time.Millisecond
+	// The smallest terminal the hunt can be drawn in.
+	MinHuntWidth	= 24
+	MinHuntHeight	= 8
+	// Terminals at least this wide get the sighting panel beside
+	// the directories instead of above them.
+	WideHuntWidth	= 64
+	// Used when the terminal's size can't be found.
+	DefaultHuntWidth	= 80
+	DefaultHuntHeight	= 24
+)
+
+// Escape codes for the terminal.
+const (
+	enterScreen	= "\x1b[?1049h\x1b[?25l"
+	leaveScreen	= "\x1b[?25h\x1b[?1049l"
+	homeCursor	= "\x1b[H"
+	clearLine	= "\x1b[K"
+	clearBelow	= "\x1b[J"
+)
+
+// A hunt through the forests on the whole screen. Every move into a
+// directory is a check, like `rabbit check`.
+type hunt struct {
+	rs		*regionSet
+	// The region the player is in.
+	df		*directoryForest
+	// Where the player is.
+	loc		string
+	// The directories the player can go to from here. The
+	// parent, if there is one, comes first.
+	exits		[]string
+	// The exit chosen.
+	cursor		int
+	// What happened last, shown at the bottom.
+	message		string
+	// The tags typed so far, while tagging. nil when not.
+	tagging		[]rune
+}
+
+// Starts a hunt at the location. The location is checked.
+func newHunt(rs *regionSet, loc string) *hunt {
+	h := &hunt{rs: rs}
+	h.enter(loc)
+	return h
+}
+
+// Moves into the location and checks it.
+func (h *hunt) enter(loc string) {
+	if err := os.Chdir(loc); err != nil {
+		h.message = fmt.Sprintf("You can't go there: %v", err)
+		return
+	}
+	h.loc = currentLocation()
+	h.df = h.rs.regionFor(h.loc)
+	h.cursor = 0
+	h.message = ""
+
+	h.exits = []string{}
+	if parent := h.df.Parent(h.loc); parent != "" {
+		h.exits = append(h.exits, parent)
+	}
+	h.exits = append(h.exits, h.df.Children(h.loc)...)
+
+	if h.df.RunOver() {
+		h.message = fmt.Sprintf("The %s run is over.", h.df.Mode().Name)
+		return
+	}
+	if r := h.df.PerformCheck(); r != nil {
+		if r.Tag() != "" {
+			h.message = fmt.Sprintf("You see the %s rabbit!", r.Tag())
+		} else {
+			h.message = "A rabbit is here!!"
+		}
+	}
+}
+
+// Returns the rabbit here, or nil if there's none.
+func (h *hunt) rabbitHere() *Rabbit {
+	return h.df.rabbits[h.loc]
+}
+
+// Handles a key. Returns false when the hunt is over.
+func (h *hunt) handle(key string) bool {
+	if h.tagging != nil {
+		switch key {
+		case "enter":
+			tag := strings.TrimSpace(string(h.tagging))
+			h.tagging = nil
+			if tag != "" {
+				h.tag(tag)
+			}
+		case "esc", "ctrl-c":
+			h.tagging = nil
+			h.message = ""
+		case "backspace":
+			if len(h.tagging) > 0 {
+				h.tagging = h.tagging[:len(h.tagging) - 1]
+			}
+		default:
+			if r, _ := utf8.DecodeRuneInString(key); utf8.RuneLen(r) == len(key) && r >= ' ' {
+				h.tagging = append(h.tagging, r)
+			}
+		}
+		return true
+	}
+
+	switch key {
+	case "q", "esc", "ctrl-c":
+		return false
+	case "up", "k":
+		if h.cursor > 0 {
+			h.cursor--
+		}
+	case "down", "j":
+		if h.cursor < len(h.exits) - 1 {
+			h.cursor++
+		}
+	case "right", "enter", "l":
+		if len(h.exits) > 0 {
+			h.enter(h.exits[h.cursor])
+		}
+	case "left", "h", "backspace":
+		if parent := h.df.Parent(h.loc); parent != "" {
+			h.enter(parent)
+		}
+	case "c":
+		h.catch()
+	case "t":
+		if h.df.IsRabbitHere() && !h.df.RunOver() {
+			h.tagging = []rune{}
+		} else {
+			h.message = "Too slow or you're seeing things."
+		}
+	}
+	return true
+}
+
+// Tries to catch the rabbit here. There's no typing challenge on
+// the hunting screen, the keystroke is quick enough.
+func (h *hunt) catch() {
+	switch {
+	case h.df.RunOver():
+		h.message = fmt.Sprintf("The %s run is over.", h.df.Mode().Name)
+	case !h.df.IsRabbitHere():
+		h.message = "Too slow or you're seeing things."
+	case h.df.PerformCatch(nil):
+		h.message = "You caught the rabbit!"
+	default:
+		h.message = "The rabbit got away..."
+	}
+}
+
+// Tries to tag the rabbit here.
+func (h *hunt) tag(tag string) {
+	switch {
+	case h.df.RunOver():
+		h.message = fmt.Sprintf("The %s run is over.", h.df.Mode().Name)
+	case !h.df.IsRabbitHere():
+		h.message = "Too slow or you're seeing things."
+	case h.df.PerformTag(tag):
+		h.message = "You successfully tagged the rabbit!"
+	default:
+		h.message = "The rabbit got away..."
+	}
+}
+
+// Returns the sighting panel, the rabbit here and the tracks.
+func (h *hunt) sighting() []string {
+	lines := []string{}
+	if r := h.rabbitHere(); r != nil {
+		lines = append(lines, rabbitArt(r.state)...)
+		if r.JustSpotted() {
+			left := r.fleeTime - r.SinceSpotted()
+			if left > 0 {
+				lines = append(lines, fmt.Sprintf("It bolts in %.1fs!", left.Seconds()))
+			} else {
+				lines = append(lines, "It's about to bolt!")
+			}
+		}
+		lines = append(lines, "")
+	}
+	for _, t := range h.df.TracksHere() {
+		lines = append(lines, describeTrack(h.df, t))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "Nothing here but leaves.")
+	}
+	return lines
+}
+
+// Returns the exits, with the chosen one marked. Only as many as fit
+// in the height are shown, around the chosen one.
+func (h *hunt) exitLines(height int) []string {
+	lines := []string{}
+	parent := h.df.Parent(h.loc)
+	for i, exit := range h.exits {
+		mark := "  "
+		if i == h.cursor {
+			mark = "> "
+		}
+		name := filepath.Base(exit) + "/"
+		if exit == parent {
+			name = "../"
+		}
+		lines = append(lines, mark + name)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "  (nowhere to go)")
+	}
+	if len(lines) > height {
+		start := h.cursor - height / 2
+		if start < 0 {
+			start = 0
+		}
+		if start > len(lines) - height {
+			start = len(lines) - height
+		}
+		lines = lines[start:start + height]
+	}
+	return lines
+}
+
+// Returns the whole screen, a line at a time, for a terminal of the
+// size. Smaller terminals get less.
+func (h *hunt) screen(width, height int) []string {
+	if width < MinHuntWidth || height < MinHuntHeight {
+		return []string{fit("Too small to hunt in.", width), fit("q to quit", width)}
+	}
+
+	lines := []string{}
+	header := "Hunting in " + prettyLocation(h.loc)
+	mode := fmt.Sprintf("(%s)", h.df.Mode().Name)
+	if utf8.RuneCountInString(header) + len(mode) + 1 <= width {
+		header += strings.Repeat(" ", width - utf8.RuneCountInString(header) - len(mode)) + mode
+	}
+	rule := strings.Repeat("-", width)
+	lines = append(lines, header, rule)
+
+	// What's left after the header, and the rule, keys and
+	// message at the bottom.
+	body := height - 5
+	panel := h.sighting()
+	if width >= WideHuntWidth {
+		left := width / 2 - 1
+		exits := h.exitLines(body)
+		for i := 0; i < body; i++ {
+			l, r := "", ""
+			if i < len(exits) {
+				l = exits[i]
+			}
+			if i < len(panel) {
+				r = panel[i]
+			}
+			lines = append(lines, fit(l, left) + " | " + r)
+		}
+	} else {
+		// The panel goes on top, but always leaves room to see
+		// where to go.
+		if len(panel) > body / 2 {
+			panel = panel[:body / 2]
+		}
+		lines = append(lines, panel...)
+		lines = append(lines, h.exitLines(body - len(panel))...)
+		for len(lines) < body + 2 {
+			lines = append(lines, "")
+		}
+	}
+
+	keys := "arrows: move  c: catch  t: tag  q: quit"
+	if width < len(keys) {
+		keys = "arrows c t q"
+	}
+	status := h.message
+	if h.tagging != nil {
+		status = "Tag the rabbit: " + string(h.tagging) + "_"
+	}
+	lines = append(lines, rule, keys, status)
+
+	for i := range lines {
+		lines[i] = fit(lines[i], width)
+	}
+	return lines
+}
+
+// Cuts the line to the width, or pads it out to it.
+func fit(line string, width int) string {
+	n := utf8.RuneCountInString(line)
+	if n > width {
+		return string([]rune(line)[:width])
+	}
+	return line + strings.Repeat(" ", width - n)
+}
+
+// Draws the screen on the terminal.
+func (h *hunt) draw() {
+	width, height, ok := terminalSize(os.Stdout)
+	if !ok {
+		width, height = DefaultHuntWidth, DefaultHuntHeight
+	}
+	var b strings.Builder
+	b.WriteString(homeCursor)
+	for i, line := range h.screen(width, height) {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(line)
+		b.WriteString(clearLine)
+	}
+	b.WriteString(clearBelow)
+	os.Stdout.WriteString(b.String())
+}
+
+// Reads keys from the terminal as they're pressed, and sends their
+// names, like "up" or "q". Closes the channel when there's nothing
+// more to read.
+func readKeys(f *os.File, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			return
+		}
+		for _, k := range parseKeys(buf[:n]) {
+			keys <- k
+		}
+	}
+}
+
+// Returns the names of the keys in what was read from the terminal.
+func parseKeys(b []byte) []string {
+	arrows := map[byte]string{'A': "up", 'B': "down", 'C': "right", 'D': "left"}
+	keys := []string{}
+	for len(b) > 0 {
+		switch {
+		case len(b) >= 3 && b[0] == 0x1b && (b[1] == '[' || b[1] == 'O') && arrows[b[2]] != "":
+			keys = append(keys, arrows[b[2]])
+			b = b[3:]
+		case b[0] == 0x1b:
+			keys = append(keys, "esc")
+			b = b[1:]
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, "enter")
+			b = b[1:]
+		case b[0] == 0x7f || b[0] == 0x08:
+			keys = append(keys, "backspace")
+			b = b[1:]
+		case b[0] == 0x03:
+			keys = append(keys, "ctrl-c")
+			b = b[1:]
+		default:
+			r, size := utf8.DecodeRune(b)
+			keys = append(keys, string(r))
+			b = b[size:]
+		}
+	}
+	return keys
+}
+
+// Hunts on the whole screen until the player quits. The player ends
+// up back where they started.
+func huntScreen(rs *regionSet) error {
+	if !isTerminal(os.Stdin) || !isTerminal(os.Stdout) {
+		return errors.New("hunting needs a terminal, try check and catch instead")
+	}
+	start, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	defer os.Chdir(start)
+
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer restore()
+	os.Stdout.WriteString(enterScreen)
+	defer os.Stdout.WriteString(leaveScreen)
+
+	h := newHunt(rs, currentLocation())
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+	tick := time.NewTicker(HuntRefreshTime)
+	defer tick.Stop()
+	for {
+		h.draw()
+		select {
+		case k, ok := <-keys:
+			if !ok || !h.handle(k) {
+				return nil
+			}
+		case <-tick.C:
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("\x1b[A\x1b[Bj\r\x1bOC\x7fé\x03"))
+	want := []string{"up", "down", "j", "enter", "right", "backspace", "é", "ctrl-c"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("parseKeys = %q, want %q", keys, want)
+	}
+}
+
+func TestHunt(t *testing.T) {
+	root := makeTree(t, 2, 2, 0)
+	defer os.RemoveAll(root)
+	start, _ := os.Getwd()
+	defer os.Chdir(start)
+
+	rs := regionSet{}
+	rs.choose([]string{root})
+	h := newHunt(&rs, root)
+	if h.loc != root || len(h.exits) != 2 {
+		t.Fatalf("hunt at %s with exits %v", h.loc, h.exits)
+	}
+
+	h.handle("down")
+	h.handle("enter")
+	if h.loc != filepath.Join(root, "dir1") || h.exits[0] != root {
+		t.Errorf("hunt went to %s with exits %v", h.loc, h.exits)
+	}
+	if len(h.df.Trail()) == 0 || h.df.Trail()[0] != h.loc {
+		t.Errorf("moving didn't check %s, trail %v", h.loc, h.df.Trail())
+	}
+	h.handle("left")
+	if h.loc != root {
+		t.Errorf("hunt went up to %s, want %s", h.loc, root)
+	}
+
+	for _, size := range [][2]int{{80, 24}, {40, 12}, {24, 8}, {10, 3}} {
+		lines := h.screen(size[0], size[1])
+		if len(lines) > size[1] {
+			t.Errorf("%dx%d screen is %d lines", size[0], size[1], len(lines))
+		}
+		for _, l := range lines {
+			if utf8.RuneCountInString(l) != size[0] {
+				t.Errorf("%dx%d screen has a line %d wide: %q", size[0], size[1],
+					utf8.RuneCountInString(l), l)
+			}
+		}
+		if size[0] >= MinHuntWidth && !strings.Contains(strings.Join(lines, "\n"), "> dir0/") {
+			t.Errorf("%dx%d screen doesn't show the exits:\n%s", size[0], size[1],
+				strings.Join(lines, "\n"))
+		}
+	}
+
+	h.handle("t")
+	if (h.tagging != nil) != h.df.IsRabbitHere() {
+		t.Errorf("tagging = %v with a rabbit here = %v", h.tagging != nil, h.df.IsRabbitHere())
+	}
+	// Keys are typed into the tag until it's done.
+	h.handle("esc")
+	if h.handle("q") {
+		t.Errorf("q didn't end the hunt")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The file rabbits read their rules from. The one in a root holds
+// the global rules, one in any other directory only applies to
+// that directory's subtree.
+const IgnoreFile = ".rabbitignore"
+
+// Directories rabbits stay out of unless a rule lets them in.
+// Patterns with a slash are matched from the root.
+var defaultIgnores = []string{
+	".*",
+	"node_modules",
+	"__pycache__",
+	"go/pkg/mod",
+}
+
+// A single line of an ignore file.
+type ignoreRule struct {
+	// The directory the rule was read from. Patterns with a
+	// slash are matched relative to it.
+	dir		string
+	pattern		string
+	// Inclusion rules start with a "!" and let rabbits back into
+	// directories an earlier rule ignored.
+	include		bool
+}
+
+// Returns true if the rule's pattern matches the path.
+func (r ignoreRule) matches(path string) bool {
+	if strings.Contains(r.pattern, "/") {
+		rel, err := filepath.Rel(r.dir, path)
+		if err != nil || !pathWithin(r.dir, path) {
+			return false
+		}
+		ok, _ := filepath.Match(strings.TrimPrefix(r.pattern, "/"), rel)
+		return ok
+	}
+	ok, _ := filepath.Match(r.pattern, filepath.Base(path))
+	return ok
+}
+
+// The rules for where rabbits may go.
+type dirRules struct {
+	// The directory the rules are relative to.
+	root		string
+	// Defaults followed by the global rules.
+	global		[]ignoreRule
+	// Rules read from per-directory files. A directory without
+	// a file maps to nil so it's only read once.
+	local		map[string][]ignoreRule
+	// Rabbits only follow symlinks to directories if set.
+	followSymlinks	bool
+	// Rabbits only cross into other file systems if set.
+	crossMounts	bool
+	// The deepest a rabbit may go below the root. Zero is no limit.
+	maxDepth	int
+	// The chance of going one directory deeper when looking for
+	// a faraway location.
+	descendChance	float64
+	// Other roots below this one. They're their own regions, so
+	// rabbits from this one stay out.
+	nested		[]string
+	// The device the root is on, if known.
+	rootDev		uint64
+	hasRootDev	bool
+}
+
+// The rules for every root. Loaded the first time they're needed.
+var rules = map[string]*dirRules{}
+
+// Returns the rules for a root, loading them if needed.
+func rulesFor(root string) *dirRules {
+	dr, ok := rules[root]
+	if !ok {
+		dr = loadRules(root)
+		rules[root] = dr
+	}
+	return dr
+}
+
+// Reads the rules for the root. The global ignore file may also set
+// options, with lines such as:
+//
+//	:max-depth 8
+//	:symlinks follow
+//	:mounts cross
+//	:descend-chance 0.8
+func loadRules(root string) *dirRules {
+	dr := &dirRules{
+		root: root,
+		local: map[string][]ignoreRule{},
+		descendChance: DescendChance,
+	}
+
+	for _, p := range defaultIgnores {
+		dr.global = append(dr.global, ignoreRule{root, p, false})
+	}
+
+	lines := readIgnoreFile(filepath.Join(root, IgnoreFile))
+	for _, line := range lines {
+		if strings.HasPrefix(line, ":") {
+			dr.setOption(line[1:])
+		} else {
+			dr.global = append(dr.global, parseIgnoreRule(root, line))
+		}
+	}
+	// Already read, no need to read it again as a local file.
+	dr.local[root] = nil
+
+	if fi, err := os.Stat(root); err == nil {
+		dr.rootDev, _, dr.hasRootDev = fileID(fi)
+	}
+	return dr
+}
+
+// Sets an option from the global ignore file. Unknown options are
+// ignored.
+func (dr *dirRules) setOption(opt string) {
+	fields := strings.Fields(opt)
+	if len(fields) != 2 {
+		return
+	}
+	switch fields[0] {
+	case "max-depth":
+		n, err := strconv.Atoi(fields[1])
+		if err == nil && n >= 0 {
+			dr.maxDepth = n
+		}
+	case "symlinks":
+		dr.followSymlinks = fields[1] == "follow"
+	case "mounts":
+		dr.crossMounts = fields[1] == "cross"
+	case "descend-chance":
+		c, err := strconv.ParseFloat(fields[1], 64)
+		if err == nil && c >= 0 {
+			dr.descendChance = math.Min(c, MaxDescendChance)
+		}
+	}
+}
+
+// Returns the non-empty, non-comment lines of an ignore file. A
+// missing file has no lines.
+func readIgnoreFile(filename string) []string {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func parseIgnoreRule(dir, line string) ignoreRule {
+	include := strings.HasPrefix(line, "!")
+	line = strings.TrimPrefix(line, "!")
+	line = strings.TrimSuffix(line, "/")
+	return ignoreRule{dir, line, include}
+}
+
+// Returns the rules read from the ignore file in dir, if any.
+func (dr *dirRules) localRules(dir string) []ignoreRule {
+	rs, ok := dr.local[dir]
+	if ok {
+		return rs
+	}
+	for _, line := range readIgnoreFile(filepath.Join(dir, IgnoreFile)) {
+		if !strings.HasPrefix(line, ":") {
+			rs = append(rs, parseIgnoreRule(dir, line))
+		}
+	}
+	dr.local[dir] = rs
+	return rs
+}
+
+// Returns true if the path is ignored by the patterns. Later rules
+// win over earlier ones, and local files are read from the root
+// down to the path's parent.
+func (dr *dirRules) ignored(path string) bool {
+	ignored := false
+	apply := func(rs []ignoreRule) {
+		for _, r := range rs {
+			if r.matches(path) {
+				ignored = !r.include
+			}
+		}
+	}
+
+	apply(dr.global)
+
+	if pathDepth(dr.root, path) > 0 {
+		parent := filepath.Dir(path)
+		dirs := []string{}
+		for d := parent; d != dr.root; d = filepath.Dir(d) {
+			dirs = append(dirs, d)
+		}
+		for i := len(dirs) - 1; i >= 0; i-- {
+			apply(dr.localRules(dirs[i]))
+		}
+	}
+	return ignored
+}
+
+// Returns true if a rabbit may enter the directory at path. The
+// file info is the one from listing the parent, so symlinks aren't
+// followed yet.
+func (dr *dirRules) allows(path string, fi os.FileInfo) bool {
+	if fi.Mode() & os.ModeSymlink != 0 {
+		if !dr.followSymlinks {
+			return false
+		}
+		target, err := os.Stat(path)
+		if err != nil {
+			return false
+		}
+		fi = target
+	}
+	if !fi.IsDir() {
+		return false
+	}
+
+	for _, n := range dr.nested {
+		if path == n {
+			return false
+		}
+	}
+
+	if dr.maxDepth > 0 && pathDepth(dr.root, path) > dr.maxDepth {
+		return false
+	}
+
+	if !dr.crossMounts && dr.hasRootDev {
+		dev, _, ok := fileID(fi)
+		if ok && dev != dr.rootDev {
+			return false
+		}
+	}
+
+	return !dr.ignored(path)
+}
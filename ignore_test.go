@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	root, err := ioutil.TempDir("", "rabbit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, d := range []string{
+		".git", "node_modules", "src/a/b/c", "src/build", "src/keep",
+		"go/pkg/mod", "go/src",
+	} {
+		os.MkdirAll(filepath.Join(root, d), 0755)
+	}
+	ioutil.WriteFile(filepath.Join(root, IgnoreFile),
+		[]byte("# comment\n:max-depth 3\nbuild\n"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "src", IgnoreFile),
+		[]byte("!build\nkeep\n"), 0644)
+
+	dr := loadRules(root)
+	allowed := func(d string) bool {
+		p := filepath.Join(root, d)
+		fi, err := os.Lstat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return dr.allows(p, fi)
+	}
+
+	for d, want := range map[string]bool{
+		".git": false,
+		"node_modules": false,
+		"go/pkg/mod": false,
+		"go/src": true,
+		"src/a/b": true,
+		"src/a/b/c": false,
+		"src/build": true,
+		"src/keep": false,
+	} {
+		if allowed(d) != want {
+			t.Errorf("allows(%s) != %v", d, want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The directory index remembers which directories rabbits may enter
+// from each directory, so moving about doesn't read and stat every
+// directory again. An entry is thrown away when the directory's
+// modification time changes, which happens whenever something in it
+// is added, removed or renamed, or when the ignore file in it or in
+// any directory above it changes. Changing a root's ignore file
+// throws away the whole root.
+type dirIndex struct {
+	// Keyed by root.
+	roots		map[string]*rootIndex
+	// Roots whose ignore file was checked this run.
+	checked		map[string]bool
+	// The modification times of ignore files looked at this run,
+	// keyed by directory.
+	ignores		map[string]time.Time
+	// Set when the index needs to be saved.
+	dirty		bool
+}
+
+// The index of a single root.
+type rootIndex struct {
+	// The modification time of the root's ignore file.
+	Rules		time.Time
+	// Keyed by directory.
+	Dirs		map[string]*indexEntry
+}
+
+type indexEntry struct {
+	// The modification time of the directory.
+	ModTime		time.Time
+	// The modification times of the ignore files in the
+	// directory and every directory above it, up to but not
+	// including the root.
+	Ignores		[]time.Time
+	// The directories rabbits may enter from here.
+	Dirs		[]string
+}
+
+// The index in use. Empty until loaded.
+var index = newDirIndex()
+
+func newDirIndex() *dirIndex {
+	return &dirIndex{map[string]*rootIndex{}, map[string]bool{}, map[string]time.Time{}, false}
+}
+
+// Returns the modification time of a file, or the zero time if it
+// doesn't exist.
+func modTime(filename string) time.Time {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
+
+// Returns the index of a root, starting over if the root's ignore
+// file changed since it was made.
+func (di *dirIndex) root(root string) *rootIndex {
+	ri, ok := di.roots[root]
+	if ok && di.checked[root] {
+		return ri
+	}
+
+	rulesTime := modTime(filepath.Join(root, IgnoreFile))
+	if !ok || !ri.Rules.Equal(rulesTime) {
+		ri = &rootIndex{rulesTime, map[string]*indexEntry{}}
+		di.roots[root] = ri
+		di.dirty = true
+	}
+	di.checked[root] = true
+	return ri
+}
+
+// Returns the directories rabbits may enter from path, reading the
+// directory only if the index is out of date.
+func (di *dirIndex) list(root, path string) []string {
+	ri := di.root(root)
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		if _, ok := ri.Dirs[path]; ok {
+			delete(ri.Dirs, path)
+			di.dirty = true
+		}
+		return []string{}
+	}
+	ignores := di.ignoreTimes(root, path)
+
+	e, ok := ri.Dirs[path]
+	if ok && e.ModTime.Equal(fi.ModTime()) && sameTimes(e.Ignores, ignores) {
+		return e.Dirs
+	}
+
+	e = &indexEntry{fi.ModTime(), ignores, readDirs(root, path)}
+	ri.Dirs[path] = e
+	di.dirty = true
+	return e.Dirs
+}
+
+// Returns the modification times of the ignore files from path up
+// to the root, the root's own left out.
+func (di *dirIndex) ignoreTimes(root, path string) []time.Time {
+	times := []time.Time{}
+	for dir := path; pathDepth(root, dir) > 0; dir = filepath.Dir(dir) {
+		t, ok := di.ignores[dir]
+		if !ok {
+			t = modTime(filepath.Join(dir, IgnoreFile))
+			di.ignores[dir] = t
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// Returns true if both lists hold the same times.
+func sameTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the index file that goes with a save file.
+func indexFile(savefile string) string {
+	return savefile + ".index"
+}
+
+// Loads the index from the file passed. The index is only a cache,
+// so if it's missing or broken an empty one is returned.
+func loadIndex(filename string) *dirIndex {
+	di := newDirIndex()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return di
+	}
+	defer file.Close()
+
+	fz, err := gzip.NewReader(file)
+	if err != nil {
+		return di
+	}
+	defer fz.Close()
+
+	bs, err := ioutil.ReadAll(fz)
+	if err != nil {
+		return di
+	}
+
+	var roots map[string]*rootIndex
+	if json.Unmarshal(bs, &roots) != nil || roots == nil {
+		return di
+	}
+	di.roots = roots
+	return di
+}
+
+// Saves the index to a file if it changed. Failing to save it only
+// makes the next run slower, so errors are ignored.
+func saveIndex(filename string, di *dirIndex) {
+	if !di.dirty {
+		return
+	}
+	bs, err := json.Marshal(di.roots)
+	if err != nil {
+		return
+	}
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	w.Write(bs)
+	w.Close()
+	ioutil.WriteFile(filename, b.Bytes(), 0644)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Makes a tree of directories, each with some files to stat.
+func makeTree(tb testing.TB, width, depth, files int) string {
+	root, err := ioutil.TempDir("", "rabbit")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	root = resolvePath(root)
+
+	var grow func(dir string, depth int)
+	grow = func(dir string, depth int) {
+		for i := 0; i < files; i++ {
+			name := filepath.Join(dir, fmt.Sprintf("file%d", i))
+			ioutil.WriteFile(name, nil, 0644)
+		}
+		if depth == 0 {
+			return
+		}
+		for i := 0; i < width; i++ {
+			sub := filepath.Join(dir, fmt.Sprintf("dir%d", i))
+			os.Mkdir(sub, 0755)
+			grow(sub, depth - 1)
+		}
+	}
+	grow(root, depth)
+	return root
+}
+
+func TestIndex(t *testing.T) {
+	root := makeTree(t, 2, 2, 0)
+	defer os.RemoveAll(root)
+
+	di := newDirIndex()
+	if len(di.list(root, root)) != 2 {
+		t.Fatalf("expected 2 dirs in %s", root)
+	}
+
+	// Make sure the modification time moves on.
+	time.Sleep(10 * time.Millisecond)
+	os.Mkdir(filepath.Join(root, "dir2"), 0755)
+	if len(di.list(root, root)) != 3 {
+		t.Errorf("index wasn't updated after adding a directory")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	ioutil.WriteFile(filepath.Join(root, "dir0", IgnoreFile), []byte("dir1\n"), 0644)
+	if len(di.list(root, filepath.Join(root, "dir0"))) != 1 {
+		t.Errorf("index wasn't updated after adding an ignore file")
+	}
+
+	// An ignore file above the directory counts too, on a later
+	// run.
+	deep := filepath.Join(root, "dir1", "dir0")
+	os.Mkdir(filepath.Join(deep, "dir0"), 0755)
+	os.Mkdir(filepath.Join(deep, "dir1"), 0755)
+	if len(di.list(root, deep)) != 2 {
+		t.Fatalf("expected 2 dirs in %s", deep)
+	}
+	filename := filepath.Join(root, "index")
+	saveIndex(filename, di)
+	ioutil.WriteFile(filepath.Join(root, "dir1", IgnoreFile), []byte("dir0/dir1\n"), 0644)
+	rules = map[string]*dirRules{}
+	if len(loadIndex(filename).list(root, deep)) != 1 {
+		t.Errorf("index wasn't updated after adding an ignore file above")
+	}
+
+	os.RemoveAll(filepath.Join(root, "dir1"))
+	if len(di.list(root, filepath.Join(root, "dir1"))) != 0 {
+		t.Errorf("removed directory still has directories")
+	}
+
+	saveIndex(filename, di)
+	loaded := loadIndex(filename)
+	if len(loaded.roots[root].Dirs) != len(di.roots[root].Dirs) {
+		t.Errorf("index wasn't saved and loaded")
+	}
+}
+
+func benchmarkNearby(b *testing.B, warm bool) {
+	root := makeTree(b, 6, 3, 30)
+	defer os.RemoveAll(root)
+
+	f := newDirectoryForest(root)
+	r := NewRabbit(&f)
+	r.movement = "random"
+	index = newDirIndex()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !warm {
+			index = newDirIndex()
+			rules = map[string]*dirRules{}
+		}
+		f.NearbyLocation(f.FarawayLocation(""), &r)
+	}
+}
+
+func BenchmarkNearbyCold(b *testing.B) {
+	benchmarkNearby(b, false)
+}
+
+func BenchmarkNearbyWarm(b *testing.B) {
+	benchmarkNearby(b, true)
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// Locks the file. There's no watcher on Windows to share the file
+// with, so there's nothing to do.
+func lockFile(file *os.File) error {
+	return nil
+}
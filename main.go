@@ -9,59 +9,124 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 var ascii bool
+var savefile string
+var roots string
+var catchGame bool
+// What rabbit exits with. Set by commands that run other commands.
+var exitStatus int
+
+// The flags of the stats command.
+var statsFlags = flag.NewFlagSet("stats", flag.ExitOnError)
+var since = statsFlags.String("since", "", "how far back to look, like 7d or 2w (default 28d)")
+var by = statsFlags.String("by", "day", "what to add up by, day or week")
+var spark = statsFlags.Bool("spark", false, "show sparklines instead of a table")
+var export = statsFlags.String("export", "", "print every region's stats as csv, prom or json")
+
+// The flags of the map command.
+var mapFlags = flag.NewFlagSet("map", flag.ExitOnError)
+var mapDepth = mapFlags.Int("depth", 0, "the most directories below the root shown (default no limit)")
+
+// The flags of the daemon command.
+var daemonFlags = flag.NewFlagSet("daemon", flag.ExitOnError)
+var textfile = daemonFlags.String("textfile", "", "keep a Prometheus textfile of the stats here")
+var every = daemonFlags.Duration("every", DefaultExportTime, "how often to rewrite the textfile")
 
 func init() {
 	flag.BoolVar(&ascii, "a", false, "use ascii art instead of words")
+	flag.StringVar(&savefile, "save", filepath.Join(os.Getenv("HOME"), ".rabbit"),
+		"the file the game is saved in")
+	flag.StringVar(&roots, "roots", os.Getenv("RABBIT_ROOTS"),
+		"directories rabbits live in, separated like $PATH (default $HOME)")
+	if d, err := time.ParseDuration(os.Getenv("RABBIT_GRACE")); err == nil {
+		graceTime = d
+	}
+	flag.DurationVar(&graceTime, "grace", graceTime,
+		"how long a rabbit survives its directory going missing")
+	flag.BoolVar(&catchGame, "game", os.Getenv("RABBIT_GAME") != "",
+		"catch rabbits with a quick typing challenge (default $RABBIT_GAME)")
 }
 
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: rabbit [-a] [stats|check|catch|tag string]\n")
+	fmt.Fprintf(os.Stderr, "usage: rabbit [-a] [-save file] [-roots dirs] [-grace time] [-game] [stats [-since time] [-by day|week] [-spark] [-export csv|prom|json]|achievements|graveyard|hotspots|map [-depth n]|check|catch|hunt|tag string|follow|listen|sniff|mode [name]|daemon [-textfile file] [-every time]|shoo dir|rm args|mv args|guard command|hook [shell]]\n")
 	flag.PrintDefaults()
 }
 
-// Loads the directory forest from the file passed, if it doesn't exist
-// a fresh directory forest is returned.
-func loadDirectoryForest(filename string) *directoryForest {
+// Loads the regions from the file passed, if it doesn't exist
+// there are no regions yet. Saves from before regions existed hold
+// a single directory forest, which becomes the base location's
+// region.
+func loadRegions(filename string) *regionSet {
+	rs, err := readRegions(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return rs
+}
+
+// Like loadRegions, but returns an error instead of giving up. The
+// daemon reads the save while rabbit writes it, it tries again later.
+func readRegions(filename string) (*regionSet, error) {
+	rs := &regionSet{regions: map[string]*directoryForest{}}
 
 	file, err := os.Open(filename)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			log.Fatal(err)
+			return nil, err
 		} else {
-			df := newDirectoryForest()
-			return &df
+			return rs, nil
 		}
 	}
 	defer file.Close()
 
 	fz, err := gzip.NewReader(file)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer fz.Close()
 
 	bytes, err := ioutil.ReadAll(fz)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	var df directoryForest
-	err = json.Unmarshal(bytes, &df)
+	var data regions
+	err = json.Unmarshal(bytes, &data)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+
+	if data.Regions == nil {
+		var df directoryForest
+		err = json.Unmarshal(bytes, &df)
+		if err != nil {
+			return nil, err
+		}
+		df.root = cleanRoot(baseLocation())
+		rs.regions[df.root] = &df
+		return rs, nil
 	}
 
-	return &df
+	for root, df := range data.Regions {
+		df.root = root
+		rs.regions[root] = df
+	}
+	rs.player = data.Player
+	return rs, nil
 }
 
-// Saves the directory forest to a file.
-func saveDirectoryForest(filename string, df *directoryForest) {
-	bs, err := json.Marshal(df)
+// Saves the regions to a file. The file is written aside and renamed
+// over, so the daemon never reads half of it.
+func saveRegions(filename string, rs *regionSet) {
+	bs, err := json.Marshal(&regions{rs.regions, rs.player})
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -69,7 +134,25 @@ func saveDirectoryForest(filename string, df *directoryForest) {
 	w := gzip.NewWriter(&b)
 	w.Write(bs)
 	w.Close()
-	err = ioutil.WriteFile(filename, b.Bytes(), 0644)
+
+	// Renaming over a symlink would replace the link, not the
+	// save it points to.
+	if real, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = real
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".rabbit")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b.Bytes()); err != nil {
+		log.Fatal(err)
+	}
+	if err := tmp.Close(); err != nil {
+		log.Fatal(err)
+	}
+	os.Chmod(tmp.Name(), 0644)
+	err = os.Rename(tmp.Name(), filename)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -105,47 +188,564 @@ func killedFlavor(count uint) string {
 }
 
 // Prints the stats. Number of rabbits seen, caught, killed, etc.
+// Only the stats of the mode being played are shown.
 func printStats(df *directoryForest) {
-	sflavor := spottedFlavor(df.spottedCount)
-	cflavor := caughtFlavor(df.caughtCount)
-	kflavor := killedFlavor(df.killedCount)
-	fmt.Printf("Rabbits\n");
-	fmt.Printf("...spotted:    %d %s\n", df.spottedCount, sflavor)
-	fmt.Printf("...caught:     %d %s\n", df.caughtCount, cflavor)
-	fmt.Printf("...killed:     %d %s\n", df.killedCount, kflavor)
+	m := df.Mode()
+	s := df.Stats()
+	sflavor := spottedFlavor(s.Spotted)
+	cflavor := caughtFlavor(s.Caught)
+	kflavor := killedFlavor(s.Killed)
+	fmt.Printf("Rabbits (%s)\n", m.Name);
+	fmt.Printf("...spotted:    %d %s\n", s.Spotted, sflavor)
+	fmt.Printf("...caught:     %d %s\n", s.Caught, cflavor)
+	fmt.Printf("...killed:     %d %s\n", s.Killed, kflavor)
+	fmt.Printf("This run: %d spotted, %d caught, %d killed.\n",
+		s.Run.Spotted, s.Run.Caught, s.Run.Killed)
+	if df.RunOver() {
+		fmt.Printf("The run is over.\n")
+	} else if m.RunTime > 0 {
+		left := s.timeLeft(m) / time.Second * time.Second
+		fmt.Printf("...time left:  %s\n", left)
+	}
 }
 
-func printRabbit(state RabbitState) {
+// Prints the stats of every region for dashboards.
+func exportStats(rs *regionSet, format string) {
+	if err := writeMetrics(os.Stdout, format, metrics(rs)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exitStatus = 1
+	}
+}
+
+// Prints what happened over time, a line per day or week, or
+// sparklines of it.
+func printHistory(df *directoryForest, since, by string, spark bool) {
+	back := DefaultSince
+	if since != "" {
+		d, err := parseSince(since)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitStatus = 1
+			return
+		}
+		back = d
+	}
+	if by != "day" && by != "week" {
+		fmt.Fprintf(os.Stderr, "Can only go by day or week, not %s.\n", by)
+		exitStatus = 1
+		return
+	}
+
+	now := time.Now()
+	periods := df.Stats().history(now.Add(-back), now, by == "week")
+	fmt.Printf("\n")
+	if spark {
+		bars := sparks
+		if ascii {
+			bars = asciiSparks
+		}
+		line := func(get func(p period) float64) string {
+			values := make([]float64, len(periods))
+			for i, p := range periods {
+				values[i] = get(p)
+			}
+			return sparkline(values, bars)
+		}
+		fmt.Printf("Since %s, by %s\n", periods[0].Start.Format("Jan _2"), by)
+		fmt.Printf("...spotted:    %s\n", line(func(p period) float64 { return float64(p.Spotted) }))
+		fmt.Printf("...caught:     %s\n", line(func(p period) float64 { return float64(p.Caught) }))
+		fmt.Printf("...tagged:     %s\n", line(func(p period) float64 { return float64(p.Tagged) }))
+		fmt.Printf("...killed:     %s\n", line(func(p period) float64 { return float64(p.Killed) }))
+		fmt.Printf("...catch time: %s\n", line(func(p period) float64 { return p.catchLatency().Seconds() }))
+		return
+	}
+
+	fmt.Printf("%-10s %7s %6s %6s %6s %10s\n", by, "spotted", "caught", "tagged", "killed", "catch time")
+	for _, p := range periods {
+		latency := "-"
+		if p.Caught > 0 {
+			latency = (p.catchLatency() / time.Millisecond * time.Millisecond).String()
+		}
+		fmt.Printf("%-10s %7d %6d %6d %6d %10s\n", p.Start.Format("Jan _2"),
+			p.Spotted, p.Caught, p.Tagged, p.Killed, latency)
+	}
+}
+
+// The number of rows in the catch curve table, from spotting to
+// fleeing.
+const CurveSteps = 10
+
+// Prints the chance of catching over the flee time for every catch
+// model, and for the mode being played with its modifiers.
+func printCatchCurve(df *directoryForest) {
+	m := df.Mode()
+	mods := forestModifiers(df)
+	fmt.Printf("Catching in %s mode, flee time %s, %s model\n", m.Name, m.FleeTime, m.CatchModel().Name())
+	for _, mod := range mods {
+		fmt.Printf("...%-15s %+.0f%%\n", mod.Name + ":", mod.Bonus * 100)
+	}
+	fmt.Printf("...%-15s %+.0f%%\n", "tagged rabbits:", TaggedBonus * 100)
+	fmt.Printf("...%-15s %+.0f%%\n", "wary rabbits:", WaryBonus * 100)
+
+	fmt.Printf("\n%-8s", "elapsed")
+	for _, name := range catchModelNames {
+		fmt.Printf(" %8s", name)
+	}
+	fmt.Printf(" %8s\n", m.Name)
+	for i := 0; i <= CurveSteps; i++ {
+		elapsed := m.FleeTime * time.Duration(i) / CurveSteps
+		fmt.Printf("%-8s", elapsed.Round(time.Millisecond))
+		for _, name := range catchModelNames {
+			c := catchChance(newCatchModel(name), elapsed, m.FleeTime, nil)
+			fmt.Printf(" %7.1f%%", c * 100)
+		}
+		fmt.Printf(" %7.1f%%\n", catchChance(m.CatchModel(), elapsed, m.FleeTime, mods) * 100)
+	}
+}
+
+// Tells the player about achievements unlocked by the command.
+func announceAchievements(rs *regionSet) {
+	for _, a := range rs.unlockAchievements(time.Now()) {
+		fmt.Printf("Achievement unlocked: %s! (%s)\n", a.Title, a.Description)
+	}
+}
+
+// Prints every achievement, and when the unlocked ones were.
+func printAchievements(rs *regionSet) {
+	for _, a := range achievements {
+		if at, ok := rs.player.Unlocked[a.Name]; ok {
+			fmt.Printf("[x] %-16s %s (%s)\n", a.Title, a.Description, at.Format("Jan _2 2006"))
+		} else {
+			fmt.Printf("[ ] %-16s %s\n", a.Title, a.Description)
+		}
+	}
+	streak := rs.player.streak(time.Now())
+	days := "days"
+	if streak == 1 {
+		days = "day"
+	}
+	fmt.Printf("Hunting streak: %d %s (best %d)\n", streak, days, rs.player.BestStreak)
+}
+
+// Returns true if the command is hunting, which keeps the streak
+// going.
+func isHunting(cmd string) bool {
+	switch cmd {
+	case "check", "catch", "tag", "follow", "listen", "sniff", "hunt":
+		return true
+	}
+	return false
+}
+
+// Prints the modes or switches to the one named.
+func mode(df *directoryForest, name string) {
+	if name == "" {
+		for _, n := range modeNames() {
+			mark := " "
+			if n == df.Mode().Name {
+				mark = "*"
+			}
+			fmt.Printf("%s %-9s %s\n", mark, n, lookupMode(n).Description)
+		}
+		return
+	}
+
+	if !df.ChangeMode(name) {
+		fmt.Printf("There is no %s mode.\n", name)
+		return
+	}
+	fmt.Printf("Now playing %s. The rabbits scatter...\n", name)
+}
+
+// Tells the player the run is over. Returns true if it was.
+func runOver(df *directoryForest) bool {
+	if !df.RunOver() {
+		return false
+	}
+	fmt.Printf("The %s run is over. Try `rabbit mode %s` to start again.\n",
+		df.Mode().Name, df.Mode().Name)
+	return true
+}
+
+// Returns the ascii art of a rabbit in the state, a line at a
+// time.
+func rabbitArt(state RabbitState) []string {
 	switch state {
 	case Wandering:
-		fmt.Printf(" ()_()\n")
-		fmt.Printf(" (-.-)\n")
-		fmt.Printf("'(\"|\")'\n")
+		return []string{
+			" ()_()",
+			" (-.-)",
+			"'(\"|\")'",
+		}
 	case Spotted:
-		fmt.Printf("(_/  _#\n")
-		fmt.Printf("'.'_( )\n")
-		//fmt.Printf("/)/)\n")
-		//fmt.Printf("(o.o)\n")
-		//fmt.Printf("c(")(")\n")
+		//"/)/)"
+		//"(o.o)"
+		//"c(")(")"
+		return []string{
+			"(_/  _#",
+			"'.'_( )",
+		}
 	case Fleeing:
-		fmt.Printf("  o __(\\\\\n")
-		fmt.Printf("   ) _ --\n")
-		fmt.Printf(" //    \\\\\n")
+		return []string{
+			"  o __(\\\\",
+			"   ) _ --",
+			" //    \\\\",
+		}
 	case Caught:
-		fmt.Printf("_________\n")
-		fmt.Printf("| ()|() |\n")
-		fmt.Printf("+---+---+\n")
-		fmt.Printf("|(\")|(\")|\n")
-		fmt.Printf("---------\n")
+		return []string{
+			"_________",
+			"| ()|() |",
+			"+---+---+",
+			"|(\")|(\")|",
+			"---------",
+		}
 	case Dead:
-		fmt.Printf("(\\ /)\n")
-		fmt.Printf("(x.x)\n")
-		fmt.Printf("(> <)\n")
+		return []string{
+			"(\\ /)",
+			"(x.x)",
+			"(> <)",
+		}
+	}
+	return nil
+}
+
+func printRabbit(state RabbitState) {
+	for _, line := range rabbitArt(state) {
+		fmt.Printf("%s\n", line)
+	}
+}
+
+// Describes a track, like "You see fresh rabbit tracks descending
+// toward sr...". Tracks of tagged rabbits are recognized.
+func describeTrack(df *directoryForest, t track) string {
+	fade := df.fadeTime(t)
+	whose := "rabbit tracks"
+	if t.Panic {
+		whose = "frantic rabbit tracks"
+	}
+	if r := df.rabbitByID(t.Rabbit); r != nil && r.Tag() != "" {
+		whose = fmt.Sprintf("tracks of the %s rabbit", r.Tag())
+	}
+	desc := fmt.Sprintf("You see %s %s %s", t.freshness(fade), whose, t.Direction)
+	if hint := t.hint(fade); hint != "" {
+		desc += " toward " + hint
+	} else {
+		desc += "..."
+	}
+	return desc
+}
+
+// Returns the location for printing, with the home directory as ~.
+func prettyLocation(loc string) string {
+	home := cleanRoot("~")
+	if pathWithin(home, loc) {
+		rel, err := filepath.Rel(home, loc)
+		if err == nil {
+			return filepath.Join("~", rel)
+		}
+	}
+	return loc
+}
+
+// Kills the rabbits whose directories the watcher saw go away, and
+// tells the player about it.
+func reportEvents(rs *regionSet) {
+	for _, e := range takeEvents(eventsFile(savefile)) {
+		for _, df := range rs.regions {
+			for _, r := range df.ApplyEvent(e) {
+				who := "A rabbit"
+				if r.Tag() != "" {
+					who = fmt.Sprintf("The %s rabbit", r.Tag())
+				}
+				fmt.Printf("%s was killed when %s was %s at %s. :(\n",
+					who, prettyLocation(e.Location), e.Cause,
+					e.Time.Format("15:04:05"))
+				if ascii {
+					printRabbit(Dead)
+				}
+			}
+		}
+	}
+}
+
+// Returns how to call a dead rabbit, like "the fluffy rabbit".
+func graveName(g *grave) string {
+	if g.Tag != "" {
+		return fmt.Sprintf("the %s rabbit", g.Tag)
+	}
+	return "a rabbit"
+}
+
+// Tells the player about rabbits that died since the last command,
+// once.
+func noticeGraves(rs *regionSet) {
+	for _, df := range rs.regions {
+		for _, g := range df.unnoticedGraves() {
+			fmt.Printf("You killed %s in %s :(\n",
+				graveName(g), prettyLocation(g.Location))
+		}
+	}
+}
+
+// Prints every rabbit that died, most recent first.
+func printGraveyard(rs *regionSet) {
+	graves := graveyard(rs)
+	if len(graves) == 0 {
+		fmt.Printf("The graveyard is empty. Keep it that way.\n")
+		return
+	}
+	for _, g := range graves {
+		fmt.Printf("%s  %-10s  %s, %s\n", g.Died.Format("Jan _2 15:04"),
+			g.Cause, prettyLocation(g.Location), graveName(g))
+	}
+	if ascii {
+		printRabbit(Dead)
+	}
+}
+
+// The most directories ranked by hotspots.
+const MaxRanked = 10
+
+// How hot a directory is in the heatmap, coldest to hottest.
+var heat = []rune(" ░▒▓█")
+var asciiHeat = []rune(" .:*#")
+
+// Ranks the directories rabbits are seen, caught and killed in the
+// most, then shows the home directory as a heatmap.
+func printHotspots(rs *regionSet) {
+	spots := hotspots(rs)
+	if len(spots) == 0 {
+		fmt.Printf("No rabbits have been seen anywhere yet.\n")
+		return
+	}
+
+	fmt.Printf("%7s %6s %6s  %s\n", "spotted", "caught", "killed", "directory")
+	for i, s := range spots {
+		if i == MaxRanked {
+			break
+		}
+		fmt.Printf("%7d %6d %6d  %s\n", s.Spotted, s.Caught, s.Killed,
+			prettyLocation(s.Location))
+	}
+
+	tree := heatTree(spots, cleanRoot("~"))
+	if len(tree) == 0 {
+		return
+	}
+	shades := heat
+	if ascii {
+		shades = asciiHeat
+	}
+	// The home directory counts everything, so the hottest is
+	// found below it.
+	hottest := uint(1)
+	for _, s := range tree[1:] {
+		if s.total() > hottest {
+			hottest = s.total()
+		}
+	}
+	fmt.Printf("\n")
+	for _, s := range tree {
+		name := filepath.Base(s.Location)
+		if s.Depth == 0 {
+			name = "~"
+		}
+		shade := shades[len(shades) - 1]
+		if s.Depth > 0 {
+			shade = shades[int(math.Ceil(float64(s.total()) / float64(hottest) * float64(len(shades) - 1)))]
+		}
+		fmt.Printf("%c %s%s (%d/%d/%d)\n", shade, strings.Repeat("  ", s.Depth),
+			name, s.Spotted, s.Caught, s.Killed)
+	}
+}
+
+// Prints the map of the region, every directory the player has been
+// to and what they know about it.
+func printMap(df *directoryForest, args []string) {
+	mapFlags.Parse(args)
+	boxes := unicodeBoxes
+	if ascii {
+		boxes = asciiBoxes
+	}
+	for _, line := range df.forestMap(currentLocation(), *mapDepth, boxes) {
+		fmt.Printf("%s\n", line)
+	}
+}
+
+// Warns about rabbits the targets put in danger, and asks whether
+// to shoo them out first. Returns true if the command should go on.
+// Without a terminal to ask on, it refuses.
+func confirmTargets(rs *regionSet, targets []target, cause string) bool {
+	rabbits := inDanger(rs, targets)
+	if len(rabbits) == 0 {
+		logTargets(rs, targets, cause)
+		return true
+	}
+
+	for _, r := range rabbits {
+		who := "A rabbit"
+		if r.Tag() != "" {
+			who = fmt.Sprintf("The %s rabbit", r.Tag())
+		}
+		fmt.Printf("%s is in %s!\n", who, prettyLocation(r.Location()))
+	}
+	if !isTerminal(os.Stdin) {
+		fmt.Printf("Not going on. Shoo them out first.\n")
+		return false
+	}
+
+	fmt.Printf("[s]hoo them out, [k]ill them or [a]bort? ")
+	var answer string
+	fmt.Scanln(&answer)
+	switch strings.ToLower(answer) {
+	case "s", "shoo":
+		dirs := []string{}
+		for _, t := range targets {
+			dirs = append(dirs, t.Location)
+		}
+		moved, stuck := shooOut(rs, dirs)
+		if moved == 1 {
+			fmt.Printf("Shooed the rabbit out.\n")
+		} else if moved > 1 {
+			fmt.Printf("Shooed %d rabbits out.\n", moved)
+		}
+		if stuck > 0 {
+			fmt.Printf("%d had nowhere to go. Not going on.\n", stuck)
+			return false
+		}
+	case "k", "kill":
+	default:
+		return false
 	}
+	logTargets(rs, targets, cause)
+	return true
+}
+
+// Shoos every rabbit out of the directory, before it's wiped.
+func shoo(rs *regionSet, dir string) {
+	dir = resolvePath(dir)
+	moved, stuck := shooOut(rs, []string{dir})
+	switch {
+	case moved == 0 && stuck == 0:
+		fmt.Printf("There are no rabbits in %s.\n", prettyLocation(dir))
+	case moved == 1:
+		fmt.Printf("Shooed a rabbit out of %s. It'll be warier now.\n", prettyLocation(dir))
+	case moved > 1:
+		fmt.Printf("Shooed %d rabbits out of %s. They'll be warier now.\n", moved, prettyLocation(dir))
+	}
+	if stuck == 1 {
+		fmt.Printf("A rabbit had nowhere to go.\n")
+	} else if stuck > 1 {
+		fmt.Printf("%d rabbits had nowhere to go.\n", stuck)
+	}
+	if stuck > 0 {
+		exitStatus = 1
+	}
+}
+
+// Runs a command, exiting with its status.
+func runCommand(name string, args []string) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		exitStatus = 1
+		if e, ok := err.(*exec.ExitError); ok {
+			exitStatus = e.ExitCode()
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
+
+// A rabbit-safe rm.
+func remove(rs *regionSet, args []string) {
+	if !confirmTargets(rs, removedBy(args), "removed") {
+		exitStatus = 1
+		return
+	}
+	runCommand("rm", args)
+}
+
+// A rabbit-safe mv.
+func move(rs *regionSet, args []string) {
+	if !confirmTargets(rs, movedBy(args), "moved") {
+		exitStatus = 1
+		return
+	}
+	runCommand("mv", args)
+}
+
+// Checks an rm or mv command line the shell is about to run, without
+// running it. Exits with 1 if it shouldn't be run.
+func guard(rs *regionSet, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	ok := true
+	switch filepath.Base(args[0]) {
+	case "rm":
+		ok = confirmTargets(rs, removedBy(args[1:]), "removed")
+	case "mv":
+		ok = confirmTargets(rs, movedBy(args[1:]), "moved")
+	}
+	if !ok {
+		exitStatus = 1
+	}
+}
+
+// Shell code that guards every rm and mv typed. In bash a refused
+// command isn't run, zsh can only warn. Bash has a single DEBUG trap,
+// so one that was already set is kept and run first.
+var hooks = map[string]string{
+	"bash": `eval "__rabbit_trap=($(trap -p DEBUG))"
+[ "${__rabbit_trap[2]}" = __rabbit_guard ] || __rabbit_prev=${__rabbit_trap[2]}
+unset __rabbit_trap
+__rabbit_guard() {
+	if [ -n "$__rabbit_prev" ]; then
+		eval "$__rabbit_prev"
+	fi
+	case "$BASH_COMMAND" in
+	rm\ *|mv\ *) rabbit guard $BASH_COMMAND ;;
+	esac
+}
+shopt -s extdebug
+trap __rabbit_guard DEBUG
+`,
+	"zsh": `__rabbit_guard() {
+	case "$1" in
+	rm\ *|mv\ *) rabbit guard ${=1} ;;
+	esac
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook preexec __rabbit_guard
+`,
+}
+
+// Prints the hook for the shell, $SHELL if none is given.
+func hook(shell string) {
+	if shell == "" {
+		shell = filepath.Base(os.Getenv("SHELL"))
+	}
+	h, ok := hooks[shell]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "There's no hook for %s, only bash and zsh.\n", shell)
+		exitStatus = 1
+		return
+	}
+	fmt.Print(h)
 }
 
 // Check the current directory for rabbits.
 func check(df *directoryForest) {
+	if runOver(df) {
+		return
+	}
+	checkHere(df)
+}
+
+// Checks the current directory, printing any rabbit or tracks.
+// Returns true if a rabbit was spotted.
+func checkHere(df *directoryForest) bool {
 	spotted := df.PerformCheck()
 	if spotted != nil {
 		if spotted.Tag() != "" {
@@ -159,27 +759,112 @@ func check(df *directoryForest) {
 				printRabbit(Spotted)
 			}
 		}
-	} else {
-		here, track := df.GetTracksHere()
-		if here {
-			if track == TrackAscending {
-				fmt.Printf("You see rabbit tracks ascending...\n")
-			} else if track == TrackDescending {
-				fmt.Printf("You see rabbit tracks descending...\n")
-			}
-			if ascii {
-				fmt.Printf(" , , ,\n")
-				fmt.Printf("= = =\n")
-				fmt.Printf(" ` ` `\n")
-			}
+		return true
+	}
+
+	tracks := df.TracksHere()
+	for _, t := range tracks {
+		fmt.Printf("%s\n", describeTrack(df, t))
+	}
+	if len(tracks) > 0 && ascii {
+		fmt.Printf(" , , ,\n")
+		fmt.Printf("= = =\n")
+		fmt.Printf(" ` ` `\n")
+	}
+	return false
+}
+
+// Describes which way something sensed is, like "in ./src" or
+// "from above".
+func senseDirection(df *directoryForest, s sensing) string {
+	loc := currentLocation()
+	switch {
+	case s.Toward == "":
+		return "right here"
+	case isAscension(s.Toward, loc):
+		return "from above"
+	default:
+		return "in ./" + filepath.Base(s.Toward)
+	}
+}
+
+// Listen for rabbits nearby. The current directory is checked
+// first, no need to listen for a rabbit you can see.
+func listen(df *directoryForest) {
+	if runOver(df) || checkHere(df) {
+		return
+	}
+	heard := df.Listen()
+	if len(heard) == 0 {
+		fmt.Printf("You hear nothing but the wind.\n")
+	}
+	for _, s := range heard {
+		fmt.Printf("You hear rustling %s.\n", senseDirection(df, s))
+	}
+}
+
+// Sniff for rabbits nearby, and where they've been. The current
+// directory is checked first.
+func sniff(df *directoryForest) {
+	if runOver(df) || checkHere(df) {
+		return
+	}
+	smelled := df.Sniff()
+	if len(smelled) == 0 {
+		fmt.Printf("You smell nothing of interest.\n")
+	}
+	for _, s := range smelled {
+		switch {
+		case s.Strength > 0.6:
+			fmt.Printf("A strong scent %s.\n", senseDirection(df, s))
+		case s.Strength > 0.3:
+			fmt.Printf("A scent %s.\n", senseDirection(df, s))
+		default:
+			fmt.Printf("A faint scent %s.\n", senseDirection(df, s))
 		}
 	}
 }
 
+// Follow the panic trail of a fleeing rabbit.
+func follow(df *directoryForest) {
+	if runOver(df) {
+		return
+	}
+	t, ok := df.PanicTrailHere()
+	if !ok {
+		fmt.Printf("There's no trail to follow here.\n")
+		return
+	}
+
+	fmt.Printf("%s\n", trailDirection(t))
+	if t.freshness(df.fadeTime(t)) == TrackOld {
+		fmt.Printf("It's going cold...\n")
+	}
+}
+
+// Describes which way a panic trail leads, like "The trail leads
+// up. (cd ..)".
+func trailDirection(t track) string {
+	if t.Direction == TrackAscending {
+		return "The trail leads up. (cd ..)"
+	}
+	name := filepath.Base(t.To)
+	return fmt.Sprintf("The trail leads into %s. (cd %s)", name, name)
+}
+
 // Try to catch a rabbit.
 func catch(df *directoryForest) {
+	if runOver(df) {
+		return
+	}
 	if df.IsRabbitHere() {
-		if df.PerformCatch() {
+		// Without a terminal to type on, catching is left to
+		// chance.
+		var score *catchScore
+		if catchGame && isTerminal(os.Stdin) {
+			score = playCatchGame(os.Stdin, os.Stdout)
+		}
+		if df.PerformCatch(score) {
 			fmt.Printf("You caught the rabbit!\n")
 			if ascii {
 				printRabbit(Caught)
@@ -197,6 +882,9 @@ func catch(df *directoryForest) {
 
 // Try to tag a rabbit.
 func tag(df *directoryForest, tag string) {
+	if runOver(df) {
+		return
+	}
 	if df.IsRabbitHere() {
 		if df.PerformTag(tag) {
 			fmt.Printf("You successfully tagged the rabbit!\n")
@@ -216,21 +904,86 @@ func tag(df *directoryForest, tag string) {
 
 func main() {
 	flag.Parse()
+	// Runs last, after everything is saved.
+	defer func() {
+		if exitStatus != 0 {
+			os.Exit(exitStatus)
+		}
+	}()
 
-	savefile := filepath.Join(os.Getenv("HOME"), ".rabbit")
-	df := loadDirectoryForest(savefile)
-	defer saveDirectoryForest(savefile, df)
+	if flag.Arg(0) == "daemon" {
+		daemonFlags.Parse(flag.Args()[1:])
+		if *textfile != "" {
+			go exportEvery(savefile, *textfile, *every)
+		}
+		// The daemon only reads the save, playing at the same
+		// time would overwrite it.
+		err := watch(savefile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if flag.Arg(0) == "stats" {
+		statsFlags.Parse(flag.Args()[1:])
+		if *export != "" {
+			// Read by other programs, nothing else may be
+			// printed. Nothing is played, so nothing is saved.
+			exportStats(loadRegions(savefile), *export)
+			return
+		}
+	}
+	if flag.Arg(0) == "hook" {
+		// Evaluated by the shell, nothing else may be printed.
+		hook(flag.Arg(1))
+		return
+	}
+
+	index = loadIndex(indexFile(savefile))
+	defer saveIndex(indexFile(savefile), index)
+
+	rs := loadRegions(savefile)
+	for _, root := range rs.choose(parseRoots(roots)) {
+		fmt.Fprintf(os.Stderr, "rabbit: %s isn't there, its rabbits are left alone.\n", root)
+	}
+	defer saveRegions(savefile, rs)
+	// Every command may unlock achievements. Runs before saving.
+	defer announceAchievements(rs)
+
+	df := rs.regionFor(currentLocation())
+
+	reportEvents(rs)
+	noticeGraves(rs)
 
 	if flag.NArg() == 0 {
 		usage()
 		return
 	}
+	if isHunting(flag.Arg(0)) {
+		rs.player.hunt(time.Now())
+	}
 
 	switch flag.Arg(0) {
 	case "stats":
 		printStats(df)
+		if statsFlags.NFlag() > 0 {
+			printHistory(df, *since, *by, *spark)
+		}
+	case "achievements":
+		printAchievements(rs)
+	case "graveyard":
+		printGraveyard(rs)
+	case "hotspots":
+		printHotspots(rs)
+	case "map":
+		printMap(df, flag.Args()[1:])
 	case "check":
 		check(df)
+	case "hunt":
+		if err := huntScreen(rs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exitStatus = 1
+		}
 	case "catch":
 		catch(df)
 	case "tag":
@@ -239,7 +992,31 @@ func main() {
 			return
 		}
 		tag(df, flag.Arg(1))
+	case "mode":
+		mode(df, flag.Arg(1))
+	case "follow":
+		follow(df)
+	case "listen":
+		listen(df)
+	case "sniff":
+		sniff(df)
+	case "shoo":
+		if flag.NArg() < 2 {
+			usage()
+			return
+		}
+		shoo(rs, flag.Arg(1))
+	case "rm":
+		remove(rs, flag.Args()[1:])
+	case "mv":
+		move(rs, flag.Args()[1:])
+	case "guard":
+		guard(rs, flag.Args()[1:])
 	case "debug":
+		if flag.Arg(1) == "catch-curve" {
+			printCatchCurve(df)
+			return
+		}
 		fmt.Printf("%+v", df)
 	default: usage()
 	}
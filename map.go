@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The most directories remembered as visited per forest. The ones
+// visited longest ago are forgotten.
+const MaxVisited = 5000
+
+// How the branches of the map are drawn.
+type boxStyle struct {
+	branch, last, pipe, space	string
+}
+
+var unicodeBoxes = boxStyle{"├── ", "└── ", "│   ", "    "}
+var asciiBoxes = boxStyle{"|-- ", "`-- ", "|   ", "    "}
+
+// Remembers that the player has been to a location, for the map.
+func (f *directoryForest) recordVisit(loc string) {
+	if f.visitedAt == nil {
+		f.visitedAt = map[string]time.Time{}
+	}
+	f.visitedAt[loc] = time.Now()
+	if len(f.visitedAt) <= MaxVisited {
+		return
+	}
+	oldest := ""
+	for l, t := range f.visitedAt {
+		if oldest == "" || t.Before(f.visitedAt[oldest]) {
+			oldest = l
+		}
+	}
+	delete(f.visitedAt, oldest)
+}
+
+// Remembers where the player last saw a tagged rabbit.
+func (f *directoryForest) sawTagged(r *Rabbit, loc string) {
+	if r.Tag() == "" {
+		return
+	}
+	if f.lastSeen == nil {
+		f.lastSeen = map[string]string{}
+	}
+	f.lastSeen[r.Tag()] = loc
+}
+
+// Returns what the player knows about each location: where there
+// are tracks, where tagged rabbits still in the forest were last
+// seen and where rabbits died. Marks are put where at says the
+// location is drawn on the map, marks of locations that aren't on it
+// are left out.
+func (f *directoryForest) mapMarks(at func(loc string) (string, bool)) map[string][]string {
+	marks := map[string][]string{}
+	tracked := map[string]bool{}
+	for loc, tl := range f.tracks {
+		for _, t := range tl {
+			if time.Now().Sub(t.Timestamp) < f.fadeTime(t) {
+				if p, ok := at(loc); ok && !tracked[p] {
+					tracked[p] = true
+					marks[p] = append(marks[p], "tracks")
+				}
+				break
+			}
+		}
+	}
+
+	alive := map[string]bool{}
+	for _, r := range f.rabbits {
+		alive[r.Tag()] = true
+	}
+	tags := []string{}
+	for tag := range f.lastSeen {
+		if alive[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		if p, ok := at(f.lastSeen[tag]); ok {
+			marks[p] = append(marks[p], tag + " last seen")
+		}
+	}
+
+	died := map[string]int{}
+	for _, g := range f.graves {
+		if p, ok := at(g.Location); ok {
+			died[p]++
+		}
+	}
+	for p, n := range died {
+		marks[p] = append(marks[p], fmt.Sprintf("%d died", n))
+	}
+	return marks
+}
+
+// Returns the map of the forest, a line at a time. Every directory
+// visited is on it, and every one a rabbit died in, down to the
+// depth below the root. A depth of 0 or less has no limit. What's
+// known about directories below the depth is marked on the deepest
+// directory above them that's shown. Here is where the player is.
+func (f *directoryForest) forestMap(here string, depth int, boxes boxStyle) []string {
+	known := map[string]bool{f.root: true}
+	add := func(loc string) {
+		if pathDepth(f.root, loc) < 0 {
+			return
+		}
+		for ; !known[loc]; loc = filepath.Dir(loc) {
+			known[loc] = true
+		}
+	}
+	for loc := range f.visitedAt {
+		add(loc)
+	}
+	for _, g := range f.graves {
+		add(g.Location)
+	}
+
+	// Where a known location is drawn, cut off at the depth.
+	at := func(loc string) (string, bool) {
+		if !known[loc] {
+			return "", false
+		}
+		for d := pathDepth(f.root, loc); depth > 0 && d > depth; d-- {
+			loc = filepath.Dir(loc)
+		}
+		return loc, true
+	}
+	marks := f.mapMarks(at)
+	children := map[string][]string{}
+	for loc := range known {
+		if p, _ := at(loc); p == loc && loc != f.root {
+			parent := filepath.Dir(loc)
+			children[parent] = append(children[parent], loc)
+		}
+	}
+	herePlace, hereOK := at(here)
+
+	label := func(loc, name string) string {
+		l := name
+		if ms := marks[loc]; len(ms) > 0 {
+			l += " [" + strings.Join(ms, ", ") + "]"
+		}
+		if hereOK && loc == herePlace {
+			if loc == here {
+				l += " <- you are here"
+			} else {
+				l += " <- you are in here"
+			}
+		}
+		return l
+	}
+	lines := []string{label(f.root, prettyLocation(f.root))}
+	var draw func(loc, prefix string)
+	draw = func(loc, prefix string) {
+		kids := children[loc]
+		sort.Strings(kids)
+		for i, kid := range kids {
+			branch, next := boxes.branch, boxes.pipe
+			if i == len(kids) - 1 {
+				branch, next = boxes.last, boxes.space
+			}
+			lines = append(lines, prefix + branch + label(kid, filepath.Base(kid)))
+			draw(kid, prefix + next)
+		}
+	}
+	draw(f.root, "")
+	return lines
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestForestMap(t *testing.T) {
+	root := "/home/grue"
+	f := newDirectoryForest(root)
+	at := func(loc string) string {
+		return filepath.Join(root, loc)
+	}
+	f.recordVisit(at("src/rabbit/docs"))
+	f.recordVisit(at("src/site"))
+	f.recordVisit(at("music"))
+	f.tracks[at("src/site")] = trackList{{time.Now(), TrackAscending, "", "", false}}
+	// Faded tracks aren't known any more.
+	f.tracks[at("music")] = trackList{{time.Now().Add(-IdleTime), TrackAscending, "", "", false}}
+	f.graves = append(f.graves, &grave{Location: at("tmp")}, &grave{Location: at("tmp/build")})
+
+	r := NewRabbit(TestForest{})
+	r.tag = "fluffy"
+	f.rabbits["far"] = &r
+	f.sawTagged(&r, at("src/rabbit"))
+	f.lastSeen["gone"] = at("music")
+
+	got := f.forestMap(at("src/site"), 0, asciiBoxes)
+	want := []string{
+		"/home/grue",
+		"|-- music",
+		"|-- src",
+		"|   |-- rabbit [fluffy last seen]",
+		"|   |   `-- docs",
+		"|   `-- site [tracks] <- you are here",
+		"`-- tmp [1 died]",
+		"    `-- build [1 died]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("map =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// What's below the depth is marked on the directories above.
+	got = f.forestMap(at("src/site"), 1, unicodeBoxes)
+	want = []string{
+		"/home/grue",
+		"├── music",
+		"├── src [tracks, fluffy last seen] <- you are in here",
+		"└── tmp [2 died]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("map 1 deep =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRecordVisit(t *testing.T) {
+	f := newDirectoryForest("/r")
+	for i := 0; i < MaxVisited; i++ {
+		loc := filepath.Join("/r", fmt.Sprint(i))
+		f.visitedAt[loc] = time.Now().Add(-time.Duration(i + 1) * time.Hour)
+	}
+	f.recordVisit("/r/new")
+	if len(f.visitedAt) != MaxVisited {
+		t.Errorf("visited %d, want %d", len(f.visitedAt), MaxVisited)
+	}
+	if _, ok := f.visitedAt[filepath.Join("/r", fmt.Sprint(MaxVisited - 1))]; ok {
+		t.Errorf("the oldest visit wasn't forgotten")
+	}
+}
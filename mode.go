@@ -0,0 +1,228 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// The mode used when none is chosen. It plays like the game
+// always has.
+const DefaultMode = "normal"
+
+// A mode is a named set of rules the game is played by. Each mode
+// keeps its own stats.
+type Mode struct {
+	Name		string
+	// A short description shown by `rabbit mode`.
+	Description	string
+	// How long a spotted rabbit waits before fleeing.
+	FleeTime	time.Duration
+	// Added to the chance of catching a rabbit. May be negative.
+	CatchBonus	float64
+	// The name of the catch model, how the chance of catching
+	// falls after a rabbit is spotted.
+	CatchCurve	string
+	// How long it takes for tracks to fade.
+	TrackFadeTime	time.Duration
+	// The number of rabbits that exist at any given time.
+	MinRabbits	int
+	MaxRabbits	int
+	// Spawn chance for rabbits.
+	SpawnChance	float64
+	// If set, killing any rabbit ends the run.
+	KillEndsRun	bool
+	// If non-zero, the run ends after this long.
+	RunTime		time.Duration
+}
+
+var modes = map[string]*Mode{
+	"normal": &Mode{
+		Name: "normal",
+		Description: "The usual hunt.",
+		FleeTime: FleeTime,
+		CatchBonus: 0,
+		TrackFadeTime: TrackFadeTime,
+		MinRabbits: MinRabbits,
+		MaxRabbits: MaxRabbits,
+		SpawnChance: SpawnChance,
+	},
+	"casual": &Mode{
+		Name: "casual",
+		Description: "Rabbits linger and are easy to catch.",
+		FleeTime: time.Duration(15) * time.Second,
+		CatchBonus: 0.25,
+		CatchCurve: "sigmoid",
+		TrackFadeTime: IdleTime / 2,
+		MinRabbits: 3,
+		MaxRabbits: MaxRabbits,
+		SpawnChance: 0.30,
+	},
+	"hunter": &Mode{
+		Name: "hunter",
+		Description: "Rabbits bolt on first sight and tracks fade fast.",
+		FleeTime: time.Duration(1500) * time.Millisecond,
+		CatchBonus: -0.10,
+		CatchCurve: "decay",
+		TrackFadeTime: IdleTime / 15,
+		MinRabbits: MinRabbits,
+		MaxRabbits: 8,
+		SpawnChance: 0.10,
+	},
+	"pacifist": &Mode{
+		Name: "pacifist",
+		Description: "Any kill ends the run.",
+		FleeTime: FleeTime,
+		CatchBonus: 0,
+		TrackFadeTime: TrackFadeTime,
+		MinRabbits: MinRabbits,
+		MaxRabbits: MaxRabbits,
+		SpawnChance: SpawnChance,
+		KillEndsRun: true,
+	},
+	"timed": &Mode{
+		Name: "timed",
+		Description: "Catch as many as possible in an hour.",
+		FleeTime: FleeTime,
+		CatchBonus: 0,
+		TrackFadeTime: TrackFadeTime,
+		MinRabbits: 5,
+		MaxRabbits: MaxRabbits,
+		SpawnChance: 0.50,
+		RunTime: time.Hour,
+	},
+}
+
+// Returns the mode with the given name, or nil if there isn't one.
+func lookupMode(name string) *Mode {
+	return modes[name]
+}
+
+// Returns the names of every mode, sorted.
+func modeNames() []string {
+	names := []string{}
+	for name := range modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the mode's catch model.
+func (m *Mode) CatchModel() CatchModel {
+	return newCatchModel(m.CatchCurve)
+}
+
+// The counts of a single run of a mode. They start over with the
+// run.
+type runStats struct {
+	Spotted		uint
+	Caught		uint
+	Killed		uint
+	Tagged		uint
+}
+
+// The stats of a mode. The counts are over every run of the mode,
+// Run holds the current run's alone.
+type modeStats struct {
+	// Number of rabbits seen.
+	Spotted		uint
+	// Number of rabbits caught.
+	Caught		uint
+	// Number of rabbits killed. :(
+	Killed		uint
+	// Number of rabbits killed, by cause of death. Kills from
+	// before causes were counted aren't in it.
+	KilledBy	map[string]uint	`json:",omitempty"`
+	// Number of rabbits tagged.
+	Tagged		uint
+	// The least time from spotting a rabbit to catching it. Zero
+	// if nothing was caught.
+	QuickestCatch	time.Duration
+	// The most directories below the root a rabbit was caught.
+	DeepestCatch	int
+	// What happened each day, keyed like "2016-04-01".
+	Daily		map[string]*dayStats	`json:",omitempty"`
+	// When the run started.
+	Started		time.Time
+	// Set when the run ended, pacifist and timed runs can end.
+	Over		bool
+	// The counts of the current run.
+	Run		runStats
+}
+
+func newModeStats() *modeStats {
+	return &modeStats{Started: time.Now()}
+}
+
+// Starts the mode's run over. The totals are kept.
+func (s *modeStats) restart() {
+	s.Started = time.Now()
+	s.Over = false
+	s.Run = runStats{}
+}
+
+// Counts a rabbit spotted.
+func (s *modeStats) recordSpot() {
+	s.Spotted++
+	s.Run.Spotted++
+	s.day(time.Now()).Spotted++
+}
+
+// Counts a rabbit tagged.
+func (s *modeStats) recordTag() {
+	s.Tagged++
+	s.Run.Tagged++
+	s.day(time.Now()).Tagged++
+}
+
+// Counts a rabbit killed at the given time, for the cause. Killing
+// a rabbit ends the run in modes where a kill does.
+func (s *modeStats) recordKill(m *Mode, died time.Time, cause string) {
+	s.Killed++
+	if s.KilledBy == nil {
+		s.KilledBy = map[string]uint{}
+	}
+	s.KilledBy[cause]++
+	s.Run.Killed++
+	s.day(died).Killed++
+	if m.KillEndsRun {
+		s.Over = true
+	}
+}
+
+// Counts a rabbit caught the given time after it was spotted, the
+// given directories deep.
+func (s *modeStats) recordCatch(elapsed time.Duration, depth int) {
+	s.Caught++
+	s.Run.Caught++
+	d := s.day(time.Now())
+	d.Caught++
+	d.CatchTime += elapsed
+	if s.QuickestCatch == 0 || elapsed < s.QuickestCatch {
+		s.QuickestCatch = elapsed
+	}
+	if depth > s.DeepestCatch {
+		s.DeepestCatch = depth
+	}
+}
+
+// Returns true if the run is over, either flagged over or out of
+// time.
+func (s *modeStats) isOver(m *Mode) bool {
+	if s.Over {
+		return true
+	}
+	if m.RunTime > 0 && time.Now().Sub(s.Started) >= m.RunTime {
+		s.Over = true
+	}
+	return s.Over
+}
+
+// Returns how much time the run has left. Zero if the mode isn't
+// timed or the run is over.
+func (s *modeStats) timeLeft(m *Mode) time.Duration {
+	if m.RunTime == 0 || s.isOver(m) {
+		return 0
+	}
+	return m.RunTime - time.Now().Sub(s.Started)
+}
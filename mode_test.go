@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunOver(t *testing.T) {
+	tests := []struct {
+		mode	string
+		// How long ago the run started.
+		started	time.Duration
+		kill	bool
+		over	bool
+	}{
+		{"normal", 0, false, false},
+		{"normal", 0, true, false},
+		{"normal", 48 * time.Hour, false, false},
+		{"casual", 0, true, false},
+		{"hunter", 0, true, false},
+		{"pacifist", 0, false, false},
+		{"pacifist", 0, true, true},
+		{"timed", 0, false, false},
+		{"timed", 59 * time.Minute, false, false},
+		{"timed", time.Hour, false, true},
+		{"timed", 0, true, false},
+	}
+	for _, test := range tests {
+		f := newDirectoryForest("/home/grue")
+		f.ChangeMode(test.mode)
+		f.Stats().Started = time.Now().Add(-test.started)
+		if test.kill {
+			f.Stats().recordKill(f.Mode(), time.Now(), CauseDeleted)
+		}
+		if f.RunOver() != test.over {
+			t.Errorf("%s run started %s ago, killed %v: over = %v, want %v",
+				test.mode, test.started, test.kill, f.RunOver(), test.over)
+		}
+		if test.over && f.Stats().timeLeft(f.Mode()) != 0 {
+			t.Errorf("%s run is over with %s left", test.mode, f.Stats().timeLeft(f.Mode()))
+		}
+	}
+}
+
+func TestChangeMode(t *testing.T) {
+	f := newDirectoryForest("/home/grue")
+	if f.ChangeMode("nonsense") || f.Mode().Name != DefaultMode {
+		t.Errorf("changed to a mode that doesn't exist")
+	}
+
+	f.ChangeMode("pacifist")
+	s := f.Stats()
+	s.recordSpot()
+	s.recordCatch(time.Second, 2)
+	s.recordTag()
+	s.recordKill(f.Mode(), time.Now(), CauseDeleted)
+	if !f.RunOver() {
+		t.Fatalf("pacifist run went on after a kill")
+	}
+
+	// Every mode keeps its own stats.
+	f.ChangeMode("normal")
+	if n := f.Stats(); n == s || n.Caught != 0 || n.Run.Caught != 0 {
+		t.Errorf("normal mode shares pacifist stats (%+v)", n)
+	}
+
+	// Starting over keeps the totals, but the run's counts are
+	// the new run's alone.
+	f.ChangeMode("pacifist")
+	if f.Stats() != s || f.RunOver() {
+		t.Fatalf("pacifist run didn't start over")
+	}
+	if s.Run != (runStats{}) {
+		t.Errorf("new run kept the last run's counts (%+v)", s.Run)
+	}
+	if s.Spotted != 1 || s.Caught != 1 || s.Tagged != 1 || s.Killed != 1 {
+		t.Errorf("totals lost when the run started over (%+v)", s)
+	}
+	if f.Reputation() != 0 {
+		t.Errorf("new run's reputation = %v, want 0", f.Reputation())
+	}
+	s.recordCatch(time.Second, 1)
+	if s.Run.Caught != 1 || s.Caught != 2 {
+		t.Errorf("caught %d this run and %d in all, want 1 and 2", s.Run.Caught, s.Caught)
+	}
+}
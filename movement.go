@@ -0,0 +1,250 @@
+package main
+
+const (
+	// Chance a sibling-aware rabbit hops sideways, like
+	// cd ../other, instead of a normal step.
+	LateralChance	= 0.35
+	// Chance a burrowing rabbit ascends. Much lower than
+	// AscendChance, they like it deep.
+	BurrowAscendChance	= 0.10
+	// The most moves a territorial rabbit strays from the
+	// center of its territory.
+	TerritoryRadius	= 3
+	// The number of faraway locations a fleeing rabbit weighs
+	// up. More is farther from the player, but slower.
+	FleeCandidates	= 8
+)
+
+// A movement strategy decides where a wandering rabbit goes. Every
+// rabbit has one.
+type MovementStrategy interface {
+	// Returns the name the strategy is saved as.
+	Name() string
+	// Returns the locations the rabbit passes through from a
+	// location, each one move from the one before. The last
+	// is where it stops. Empty if the rabbit can't move.
+	Walk(f Forest, from string) []string
+}
+
+// The name of the strategy rabbits use unless told otherwise.
+const DefaultMovement = "random"
+
+// Returns the movement strategy with the given name. A territorial
+// rabbit stays around its territory. Unknown names get the default.
+func newMovement(name, territory string) MovementStrategy {
+	switch name {
+	case "sibling":
+		return siblingMovement{}
+	case "burrow":
+		return burrowMovement{}
+	case "territory":
+		return territoryMovement{territory, TerritoryRadius}
+	default:
+		return randomMovement{}
+	}
+}
+
+// Picks a movement strategy for a new rabbit. Most rabbits just
+// wander randomly.
+func randMovementName() string {
+	f := randFloat()
+	switch {
+	case f < 0.50: return "random"
+	case f < 0.70: return "sibling"
+	case f < 0.85: return "burrow"
+	default: return "territory"
+	}
+}
+
+// Returns a random location from the list.
+func randLocation(locs []string) string {
+	return locs[randRange(0, uint(len(locs) - 1))]
+}
+
+// Takes a single step up or down. Ascends with the passed chance,
+// otherwise descends, and does the other when it can't. Returns ""
+// if it can't move at all.
+func step(f Forest, loc string, ascend float64) string {
+	parent := f.Parent(loc)
+	children := f.Children(loc)
+
+	switch {
+	case parent == "" && len(children) == 0:
+		return ""
+	case parent != "" && (len(children) == 0 || chance(ascend)):
+		return parent
+	default:
+		return randLocation(children)
+	}
+}
+
+// Takes the given number of steps. It won't end where it started,
+// since you must step twice to get back to the same place, only the
+// first step is kept in that case.
+func walk(from string, steps int, next func(string) string) []string {
+	path := []string{}
+	loc := from
+	for i := 0; i < steps; i++ {
+		loc = next(loc)
+		if loc == "" {
+			break
+		}
+		path = append(path, loc)
+	}
+	if len(path) > 1 && path[len(path) - 1] == from {
+		path = path[:1]
+	}
+	return path
+}
+
+// Returns where a fleeing rabbit runs to. A handful of faraway
+// locations are weighed up, and the one farthest from anywhere the
+// player has been lately wins, then the one farthest from where the
+// player is now.
+func fleeLocation(f Forest, from string) string {
+	trail := f.Trail()
+	if len(trail) == 0 {
+		return f.FarawayLocation(from)
+	}
+
+	// Unreachable locations are as far as it gets.
+	dist := func(a, b string) int {
+		d := f.Distance(a, b)
+		if d < 0 {
+			return int(^uint(0) >> 1)
+		}
+		return d
+	}
+
+	best := ""
+	bestNearest, bestCurrent := -1, -1
+	for i := 0; i < FleeCandidates; i++ {
+		c := f.FarawayLocation(from)
+		current := dist(c, trail[0])
+		nearest := current
+		for _, t := range trail[1:] {
+			if d := dist(c, t); d < nearest {
+				nearest = d
+			}
+		}
+		if nearest > bestNearest || (nearest == bestNearest && current > bestCurrent) {
+			best, bestNearest, bestCurrent = c, nearest, current
+		}
+	}
+	return best
+}
+
+// The way rabbits have always moved. One or two steps, usually
+// down.
+type randomMovement struct {}
+
+func (m randomMovement) Name() string {
+	return "random"
+}
+
+func (m randomMovement) Walk(f Forest, from string) []string {
+	steps := 1
+	if chance(TwoStepChance) {
+		steps = 2
+	}
+	return walk(from, steps, func(loc string) string {
+		return step(f, loc, AscendChance)
+	})
+}
+
+// Like the random movement, but sometimes hops sideways into a
+// sibling directory.
+type siblingMovement struct {}
+
+func (m siblingMovement) Name() string {
+	return "sibling"
+}
+
+func (m siblingMovement) Walk(f Forest, from string) []string {
+	steps := 1
+	if chance(TwoStepChance) {
+		steps = 2
+	}
+	return walk(from, steps, func(loc string) string {
+		if chance(LateralChance) {
+			siblings := []string{}
+			parent := f.Parent(loc)
+			if parent != "" {
+				for _, s := range f.Children(parent) {
+					if s != loc {
+						siblings = append(siblings, s)
+					}
+				}
+			}
+			if len(siblings) > 0 {
+				return randLocation(siblings)
+			}
+		}
+		return step(f, loc, AscendChance)
+	})
+}
+
+// Burrowing rabbits take more steps and rarely go up.
+type burrowMovement struct {}
+
+func (m burrowMovement) Name() string {
+	return "burrow"
+}
+
+func (m burrowMovement) Walk(f Forest, from string) []string {
+	steps := int(randRange(1, 3))
+	return walk(from, steps, func(loc string) string {
+		return step(f, loc, BurrowAscendChance)
+	})
+}
+
+// Territorial rabbits stay within a few moves of the center of
+// their territory. When they're outside it, say after fleeing, they
+// head back.
+type territoryMovement struct {
+	center		string
+	radius		int
+}
+
+func (m territoryMovement) Name() string {
+	return "territory"
+}
+
+func (m territoryMovement) Walk(f Forest, from string) []string {
+	if m.center == "" {
+		return randomMovement{}.Walk(f, from)
+	}
+
+	steps := 1
+	if chance(TwoStepChance) {
+		steps = 2
+	}
+	return walk(from, steps, func(loc string) string {
+		// Copied, the children may be shared with the index.
+		moves := append([]string{}, f.Children(loc)...)
+		if parent := f.Parent(loc); parent != "" {
+			moves = append(moves, parent)
+		}
+
+		inside := []string{}
+		closest := ""
+		closestDist := -1
+		for _, l := range moves {
+			d := f.Distance(m.center, l)
+			if d < 0 {
+				continue
+			}
+			if d <= m.radius {
+				inside = append(inside, l)
+			}
+			if closestDist < 0 || d < closestDist {
+				closest, closestDist = l, d
+			}
+		}
+
+		if len(inside) > 0 {
+			return randLocation(inside)
+		}
+		return closest
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Locations in a directory forest are always absolute, clean paths
+// with symlinks resolved, so the same directory is always the same
+// string. Comparisons between locations are done on whole path
+// components, never on raw string prefixes, so /home/grue2 is not
+// inside /home/grue.
+
+// Returns the canonical form of a path. Relative paths are made
+// absolute from the working directory, and symlinks are resolved if
+// the path exists.
+func resolvePath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return abs
+	}
+	return real
+}
+
+// Returns the canonical working directory. This is where the player
+// is.
+func currentLocation() string {
+	loc, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return resolvePath(loc)
+}
+
+// Splits a clean path into its components. The root directory has
+// none.
+func pathParts(path string) []string {
+	path = filepath.Clean(path)
+	vol := filepath.VolumeName(path)
+	path = strings.Trim(path[len(vol):], string(filepath.Separator))
+	if path == "" {
+		return []string{vol}
+	}
+	return append([]string{vol}, strings.Split(path, string(filepath.Separator))...)
+}
+
+// Returns how many directories below root the path is. Zero is the
+// root itself, and -1 means the path isn't inside the root at all.
+func pathDepth(root, path string) int {
+	rparts := pathParts(root)
+	pparts := pathParts(path)
+	if len(pparts) < len(rparts) {
+		return -1
+	}
+	for i := range rparts {
+		if rparts[i] != pparts[i] {
+			return -1
+		}
+	}
+	return len(pparts) - len(rparts)
+}
+
+// Returns the directories passed going from one path to the other,
+// one cd at a time. Up to the deepest directory they share, then
+// down. The last is to, from isn't included.
+func treePath(from, to string) []string {
+	path := []string{}
+	loc := filepath.Clean(from)
+	for !pathWithin(loc, to) {
+		parent := filepath.Dir(loc)
+		if parent == loc {
+			return path
+		}
+		loc = parent
+		path = append(path, loc)
+	}
+
+	down := []string{}
+	for l := filepath.Clean(to); l != loc; l = filepath.Dir(l) {
+		down = append(down, l)
+	}
+	for i := len(down) - 1; i >= 0; i-- {
+		path = append(path, down[i])
+	}
+	return path
+}
+
+// Returns true if the path is the root or inside it.
+func pathWithin(root, path string) bool {
+	return pathDepth(root, path) >= 0
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathDepth(t *testing.T) {
+	tests := []struct {
+		root	string
+		path	string
+		depth	int
+	}{
+		{"/home/grue", "/home/grue", 0},
+		{"/home/grue", "/home/grue/", 0},
+		{"/home/grue", "/home/grue/data", 1},
+		{"/home/grue", "/home/grue/data/src", 2},
+		{"/home/grue", "/home/grue/./data/../data", 1},
+		{"/home/grue", "/home/grue2", -1},
+		{"/home/grue", "/home/grue2/data", -1},
+		{"/home/grue", "/home", -1},
+		{"/home/grue", "/", -1},
+		{"/", "/home", 1},
+		{"/", "/", 0},
+	}
+	for _, test := range tests {
+		d := pathDepth(test.root, test.path)
+		if d != test.depth {
+			t.Errorf("pathDepth(%s, %s) = %d, want %d",
+				test.root, test.path, d, test.depth)
+		}
+	}
+}
+
+func TestTrackDirections(t *testing.T) {
+	tests := []struct {
+		to		string
+		from		string
+		ascension	bool
+		descension	bool
+	}{
+		{"/home/grue", "/home/grue/data", true, false},
+		{"/home/grue/data", "/home/grue", false, true},
+		{"/home/grue", "/home/grue", false, false},
+		// Siblings sharing a prefix are neither.
+		{"/home/grue", "/home/grue2", false, false},
+		{"/home/grue2", "/home/grue", false, false},
+		{"/home/grue2/data", "/home/grue", false, false},
+		{"/home/gr", "/home/grue/data", false, false},
+	}
+	for _, test := range tests {
+		if isAscension(test.to, test.from) != test.ascension {
+			t.Errorf("isAscension(%s, %s) != %v",
+				test.to, test.from, test.ascension)
+		}
+		if isDescension(test.to, test.from) != test.descension {
+			t.Errorf("isDescension(%s, %s) != %v",
+				test.to, test.from, test.descension)
+		}
+	}
+}
+
+func TestCanAscend(t *testing.T) {
+	tests := []struct {
+		root	string
+		path	string
+		can	bool
+	}{
+		{"/home/grue", "/home/grue/data", true},
+		{"/home/grue", "/home/grue", false},
+		{"/home/grue", "/home/grue2", false},
+		{"/home/grue", "/home/grue2/data", false},
+	}
+	for _, test := range tests {
+		if canAscend(test.root, test.path) != test.can {
+			t.Errorf("canAscend(%s, %s) != %v",
+				test.root, test.path, test.can)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "rabbit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	tmp = resolvePath(tmp)
+
+	real := filepath.Join(tmp, "real")
+	os.Mkdir(real, 0755)
+	os.Mkdir(filepath.Join(real, "data"), 0755)
+	link := filepath.Join(tmp, "link")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skip("no symlinks:", err)
+	}
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(link)
+
+	tests := []struct {
+		path	string
+		want	string
+	}{
+		{link, real},
+		{filepath.Join(link, "data"), filepath.Join(real, "data")},
+		{".", real},
+		{"data", filepath.Join(real, "data")},
+		{"data/..", real},
+		{"missing", filepath.Join(real, "missing")},
+	}
+	for _, test := range tests {
+		got := resolvePath(test.path)
+		if got != test.want {
+			t.Errorf("resolvePath(%s) = %s, want %s", test.path, got, test.want)
+		}
+	}
+
+	if currentLocation() != real {
+		t.Errorf("currentLocation() = %s, want %s", currentLocation(), real)
+	}
+}
+
+func TestTreePath(t *testing.T) {
+	tests := []struct {
+		from	string
+		to	string
+		path	[]string
+	}{
+		{"/h/a/b", "/h/c/d", []string{"/h/a", "/h", "/h/c", "/h/c/d"}},
+		{"/h/a/b", "/h", []string{"/h/a", "/h"}},
+		{"/h", "/h/a/b", []string{"/h/a", "/h/a/b"}},
+		{"/h/grue", "/h/grue2", []string{"/h", "/h/grue2"}},
+		{"/h", "/h", []string{}},
+	}
+	for _, test := range tests {
+		path := treePath(test.from, test.to)
+		if fmt.Sprint(path) != fmt.Sprint(test.path) {
+			t.Errorf("treePath(%s, %s) = %v, want %v",
+				test.from, test.to, path, test.path)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -24,6 +25,9 @@ const (
 	// If the rabbit died this will be the state. The rabbit only dies
 	// if the location it's in no longer exists.
 	Dead
+	// The location the rabbit is in went missing. If it doesn't
+	// come back within the grace time, the rabbit dies.
+	Displaced
 )
 
 const (
@@ -37,23 +41,62 @@ const (
 	Catch
 	// When a rabbit dies. :(
 	Kill
+	// When the rabbit's location goes missing.
+	Displace
+	// When the rabbit is shooed out of a directory.
+	Shoo
 )
 
 // The time that elapses before a rabbit wants to moved.
 const IdleTime = time.Duration(5) * time.Minute
 // The time that elapses before a rabbit moves after being spotted.
 const FleeTime = time.Duration(5) * time.Second
+// The time a displaced rabbit waits for its location to come back
+// before it dies. Builds and checkouts often remove and recreate
+// directories within seconds.
+const GraceTime = time.Duration(30) * time.Second
+
+// The grace time in use. Changed with the -grace flag.
+var graceTime = GraceTime
+// Every time a rabbit is shooed its flee time is multiplied by this,
+// down to the least flee time. Shooed rabbits get warier.
+const WaryFactor = 0.8
+const MinFleeTime = time.Duration(2) * time.Second
 
 // A forest is a place that can be traversed. Locations in a forest
 // are simple strings.
 type Forest interface {
 	// Returns true if passed location exists.
 	LocationExists(loc string) bool
-	// Returns a location fairly close to the one provided.
-	NearbyLocation(loc string) string
+	// Returns a location fairly close to the one provided,
+	// found with the rabbit's movement strategy.
+	NearbyLocation(loc string, r *Rabbit) string
 	// Returns a faraway location, this could be anywhere
 	// except the location passed (unless it's the only location).
 	FarawayLocation(loc string) string
+	// Returns where the rabbit flees to from the location.
+	FleeLocation(loc string, r *Rabbit) string
+	// Returns the mode, the rules rabbits in this forest live by.
+	Mode() *Mode
+	// Returns the location one move up, or "" if there isn't
+	// one.
+	Parent(loc string) string
+	// Returns the locations one move down.
+	Children(loc string) []string
+	// Returns the number of moves up and down between two
+	// locations, or -1 if there's no way between them.
+	Distance(from, to string) int
+	// Returns where the player has been lately, most recent
+	// first.
+	Trail() []string
+	// Returns something that identifies the location even if it
+	// moves, or "" if there's nothing.
+	LocationID(loc string) string
+	// Returns where the location with the ID went, now that it's
+	// no longer at loc. "" if it's gone for good.
+	FindLocation(loc, id string, byName bool) string
+	// Returns how rabbits think of the player, from -1 to 1.
+	Reputation() float64
 }
 
 // A rabbit is a simple creature that likes to move around a forest. You can
@@ -61,9 +104,14 @@ type Forest interface {
 type Rabbit struct {
 	// The forest the rabbit lives in.
 	home		Forest
+	// Identifies the rabbit. Tracks say which rabbit left them.
+	id		string
 	// The current location in the forest. May be "", in which
 	// case the rabbit is no longer in the forest (dead, caught).
 	location	string
+	// Identifies the location, so the rabbit can follow it if
+	// it's moved.
+	locationID	string
 	// A tag identifying this specific rabbit.
 	tag		string
 	// The last location visited. May be "", in which case the
@@ -73,12 +121,26 @@ type Rabbit struct {
 	lastMoved	time.Time
 	// The time the rabbit was spotted last. May be nil.
 	lastSpotted	*time.Time
+	// The time the rabbit's location went missing. Zero unless
+	// the rabbit is displaced, or died displaced.
+	displacedAt	time.Time
+	// Why the location went missing, like "deleted".
+	displacedBy	string
 	// State of the rabbit.
 	state		RabbitState
+	// The name of the rabbit's movement strategy.
+	movement	string
+	// Where the rabbit first settled. Territorial rabbits stay
+	// close to it.
+	territory	string
 
 	// These are set to the defaults.
 	idleTime	time.Duration
 	fleeTime	time.Duration
+
+	// The time the rabbit is judged at during a catch. Zero is
+	// now.
+	clock		time.Time
 }
 
 var rMachine Machine
@@ -91,25 +153,39 @@ func init() {
 	rMachine.AddTransition(State(Wandering), Action(Spot), State(Spotted))
 	rMachine.AddTransition(State(Wandering), Action(Catch), State(Caught))
 	rMachine.AddTransition(State(Wandering), Action(Kill), State(Dead))
+	rMachine.AddTransition(State(Wandering), Action(Displace), State(Displaced))
+	rMachine.AddTransition(State(Wandering), Action(Shoo), State(Fleeing))
 
 	rMachine.AddTransition(State(Spotted), Action(Wait), State(Fleeing))
 	// Can't spot an already spotted rabbit.
 	rMachine.AddTransition(State(Spotted), Action(Flee), State(Fleeing))
 	rMachine.AddTransition(State(Spotted), Action(Catch), State(Caught))
 	rMachine.AddTransition(State(Spotted), Action(Kill), State(Dead))
+	rMachine.AddTransition(State(Spotted), Action(Displace), State(Displaced))
+	rMachine.AddTransition(State(Spotted), Action(Shoo), State(Fleeing))
 
 	rMachine.AddTransition(State(Fleeing), Action(Wait), State(Wandering))
 	// Can't spot or catch a fleeing rabbit.
 	rMachine.AddTransition(State(Fleeing), Action(Kill), State(Dead))
+	rMachine.AddTransition(State(Fleeing), Action(Flee), State(Fleeing))
+	rMachine.AddTransition(State(Fleeing), Action(Displace), State(Displaced))
+	rMachine.AddTransition(State(Fleeing), Action(Shoo), State(Fleeing))
+
+	// Once its location is back, the rabbit wanders off nearby.
+	rMachine.AddTransition(State(Displaced), Action(Wait), State(Wandering))
+	rMachine.AddTransition(State(Displaced), Action(Kill), State(Dead))
 }
 
 // Creates a new rabbit and moves it to a faraway location.
 func NewRabbit(f Forest) Rabbit {
 	r := Rabbit{
-		f, "", "", "", time.Now(), nil, Wandering,
-		IdleTime, FleeTime,
+		f, newRabbitID(), "", "", "", "", time.Now(), nil, time.Time{}, "", Wandering,
+		randMovementName(), "",
+		IdleTime, f.Mode().FleeTime,
+		time.Time{},
 	}
-	r.location = f.FarawayLocation("")
+	r.setLocation(f.FarawayLocation(""))
+	r.territory = r.location
 	return r
 }
 
@@ -125,17 +201,18 @@ func (r *Rabbit) ShouldTransition(act Action, to State) bool {
 
 	switch ract {
 	case Wait:
-		if rstate == Wandering {
-			return time.Now().Sub(r.lastMoved) >= r.idleTime
+		if rstate == Wandering && r.state == Displaced {
+			return r.home.LocationExists(r.location)
+		} else if rstate == Wandering {
+			return r.now().Sub(r.lastMoved) >= r.idleTime
 		} else if rstate == Fleeing {
-			return time.Now().Sub(*r.lastSpotted) >= r.fleeTime
+			return r.now().Sub(*r.lastSpotted) >= r.fleeTime
 		} else {
 			panic("Waiting when not wandering or fleeing.")
 		}
 	case Catch:
-		elapsed := time.Now().Sub(*r.lastSpotted)
-		catchchance := 1.0 - float64(elapsed) / float64(FleeTime)
-		return chance(catchchance)
+		// No catching a rabbit before it's spotted.
+		return r.lastSpotted != nil
 	default:
 		return true
 	}
@@ -147,9 +224,11 @@ func (r *Rabbit) EnterState(state State) {
 
 	switch rstate {
 	case Wandering:
+		r.displacedAt = time.Time{}
+		r.displacedBy = ""
 		r.lastMoved = time.Now()
 		r.lastLocation = r.location
-		r.location = r.home.NearbyLocation(r.location)
+		r.setLocation(r.home.NearbyLocation(r.location, r))
 		r.state = rstate
 	case Spotted:
 		// Uh-oh!
@@ -158,15 +237,21 @@ func (r *Rabbit) EnterState(state State) {
 		r.lastSpotted = &t
 		// Will start to flee the next update.
 	case Fleeing:
-		r.lastMoved = time.Now()
-		r.lastLocation = r.location
-		r.location = r.home.FarawayLocation(r.location)
-		r.state = rstate
+		r.flee(r.home.FleeLocation(r.location, r))
 	case Caught:
-		r.location = ""
+		r.setLocation("")
 		r.state = rstate
 	case Dead:
-		r.location = ""
+		// Remember where it died.
+		r.lastLocation = r.location
+		r.setLocation("")
+		r.state = rstate
+	case Displaced:
+		// The time may already be set, if it's known exactly
+		// when the location went missing.
+		if r.displacedAt.IsZero() {
+			r.displacedAt = time.Now()
+		}
 		r.state = rstate
 	default:
 	}
@@ -182,6 +267,67 @@ func (r *Rabbit) wakeup() bool {
 	return true
 }
 
+// Moves the rabbit to where it flees.
+func (r *Rabbit) flee(to string) {
+	r.lastMoved = time.Now()
+	r.lastLocation = r.location
+	r.setLocation(to)
+	r.state = Fleeing
+}
+
+// Moves the rabbit, remembering what identifies the location.
+func (r *Rabbit) setLocation(loc string) {
+	r.location = loc
+	r.locationID = ""
+	if loc != "" {
+		r.locationID = r.home.LocationID(loc)
+	}
+}
+
+// The rabbit's location is gone. If it was only moved, the rabbit
+// moves with it. Returns true if the rabbit found its new place.
+// A directory known to have moved may be found by its name.
+func (r *Rabbit) followLocation(moved bool) bool {
+	if r.location == "" || r.locationID == "" {
+		return false
+	}
+	loc := r.home.FindLocation(r.location, r.locationID, moved)
+	if loc == "" {
+		return false
+	}
+	r.setLocation(loc)
+	return true
+}
+
+// The rabbit's location went missing at the given time, for the
+// cause given. Does nothing if the rabbit is already displaced.
+func (r *Rabbit) Displace(at time.Time, cause string) {
+	if r.state == Displaced {
+		return
+	}
+	r.displacedAt = at
+	r.displacedBy = cause
+	if !rMachine.Perform(r, Displace) {
+		r.displacedAt = time.Time{}
+		r.displacedBy = ""
+	}
+}
+
+// Makes the rabbit flee to the location, without being spotted.
+// Returns false if it can't right now. It gets warier, and flees
+// quicker when it's spotted from now on.
+func (r *Rabbit) Shoo(to string) bool {
+	if _, ok := rMachine.Next(r, Shoo); !ok {
+		return false
+	}
+	r.flee(to)
+	r.fleeTime = time.Duration(float64(r.fleeTime) * WaryFactor)
+	if r.fleeTime < MinFleeTime {
+		r.fleeTime = MinFleeTime
+	}
+	return true
+}
+
 // Used mostly for testing. The default is preferred.
 func (r *Rabbit) setIdleTime(d time.Duration) {
 	r.idleTime = d
@@ -210,8 +356,15 @@ func (r *Rabbit) DisturbanceAt(loc string) {
 
 // Attempts to catch the rabbit. The rabbit first checks if
 // it already moved with wakeup(). The chance to catch the
-// rabbit is the inverse of the time is has left before moving.
-func (r *Rabbit) TryCatch(loc string) bool {
+// rabbit is its CatchChance, raised or lowered by how the player
+// did at the catch challenge. The score may be nil if there was no
+// challenge. With a challenge, the rabbit is judged as of when it
+// was shown, so only the player's skill changes the outcome.
+func (r *Rabbit) TryCatch(loc string, score *catchScore) bool {
+	if score != nil {
+		r.clock = score.Shown
+		defer func() { r.clock = time.Time{} }()
+	}
 	if !r.wakeup() {
 		return false
 	}
@@ -220,7 +373,11 @@ func (r *Rabbit) TryCatch(loc string) bool {
 		return false
 	}
 
-	if !rMachine.Perform(r, Catch) {
+	c := r.CatchChance()
+	if score != nil {
+		c = score.apply(c)
+	}
+	if !chance(c) || !rMachine.Perform(r, Catch) {
 		// Oh-well, better luck next time.
 		rMachine.Perform(r, Flee)
 		return false
@@ -243,11 +400,43 @@ func (r *Rabbit) TryTag(loc, tag string) bool {
 	return true
 }
 
+// Returns how long ago the rabbit was spotted. Zero if it never
+// was.
+func (r *Rabbit) SinceSpotted() time.Duration {
+	if r.lastSpotted == nil {
+		return 0
+	}
+	return r.now().Sub(*r.lastSpotted)
+}
+
+// Returns the time the rabbit is judged at.
+func (r *Rabbit) now() time.Time {
+	if r.clock.IsZero() {
+		return time.Now()
+	}
+	return r.clock
+}
+
 // Returns the current location of the rabbit.
 func (r *Rabbit) Location() string {
 	return r.location
 }
 
+// Returns a new random rabbit ID.
+func newRabbitID() string {
+	return fmt.Sprintf("%08x", uint32(randUint()))
+}
+
+// Returns the rabbit's ID.
+func (r *Rabbit) ID() string {
+	return r.id
+}
+
+// Returns how the rabbit moves about.
+func (r *Rabbit) Movement() MovementStrategy {
+	return newMovement(r.movement, r.territory)
+}
+
 // Returns the current tag of the rabbit, "" is none.
 func (r *Rabbit) Tag() string {
 	return r.tag
@@ -261,23 +450,38 @@ func (r *Rabbit) JustSpotted() bool {
 
 // Returns true if the rabbit is apart of the game. The rabbit
 // is no longer playing if it's caught/dead/etc. Or if the location
-// the rabbit is no longer exists.
+// the rabbit is in has been missing for longer than the grace time,
+// and wasn't just moved.
 func (r *Rabbit) IsPlaying() bool {
-	if !r.home.LocationExists(r.location) {
+	if r.state == Dead || r.state == Caught {
+		return false
+	}
+	if r.home.LocationExists(r.location) || r.followLocation(r.displacedBy == CauseMovedAway) {
+		return true
+	}
+
+	r.Displace(time.Now(), CauseDeleted)
+	if time.Now().Sub(r.displacedAt) >= graceTime {
 		rMachine.Perform(r, Kill)
 		return false
 	}
-	return r.state != Dead && r.state != Caught
+	return true
 }
 
 // Used for marshalling/unmarshalling.
 type rabbit struct {
+	ID		string
 	Location	string
+	LocationID	string
 	Tag		string
 	LastLocation	string
 	LastMoved	time.Time
 	LastSpotted	*time.Time
+	DisplacedAt	time.Time
+	DisplacedBy	string	`json:",omitempty"`
 	State		RabbitState
+	Movement	string
+	Territory	string
 	IdleTime	time.Duration
 	FleeTime	time.Duration
 }
@@ -288,12 +492,24 @@ func (r *Rabbit) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+	r.id = data.ID
+	if r.id == "" {
+		r.id = newRabbitID()
+	}
 	r.location = data.Location
+	r.locationID = data.LocationID
 	r.tag = data.Tag
 	r.lastLocation = data.LastLocation
 	r.lastMoved = data.LastMoved
 	r.lastSpotted = data.LastSpotted
+	r.displacedAt = data.DisplacedAt
+	r.displacedBy = data.DisplacedBy
 	r.state = data.State
+	r.movement = data.Movement
+	r.territory = data.Territory
+	if r.movement == "" {
+		r.movement = DefaultMovement
+	}
 	r.idleTime = data.IdleTime
 	r.fleeTime = data.FleeTime
 	return nil
@@ -301,12 +517,18 @@ func (r *Rabbit) UnmarshalJSON(b []byte) error {
 
 func (r *Rabbit) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&rabbit{
+		ID: r.id,
 		Location: r.location,
+		LocationID: r.locationID,
 		Tag: r.tag,
 		LastLocation: r.lastLocation,
 		LastMoved: r.lastMoved,
 		LastSpotted: r.lastSpotted,
+		DisplacedAt: r.displacedAt,
+		DisplacedBy: r.displacedBy,
 		State: r.state,
+		Movement: r.movement,
+		Territory: r.territory,
 		IdleTime: r.idleTime,
 		FleeTime: r.fleeTime,
 	})
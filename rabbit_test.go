@@ -3,6 +3,11 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -13,7 +18,7 @@ func (tf TestForest) LocationExists(loc string) bool {
 	return true
 }
 
-func (tf TestForest) NearbyLocation(loc string) string {
+func (tf TestForest) NearbyLocation(loc string, r *Rabbit) string {
 	var buffer bytes.Buffer
 	buffer.WriteString(loc)
 	buffer.WriteString("1")
@@ -24,6 +29,42 @@ func (tf TestForest) FarawayLocation(loc string) string {
 	return "far"
 }
 
+func (tf TestForest) FleeLocation(loc string, r *Rabbit) string {
+	return tf.FarawayLocation(loc)
+}
+
+func (tf TestForest) Mode() *Mode {
+	return lookupMode(DefaultMode)
+}
+
+func (tf TestForest) Parent(loc string) string {
+	return ""
+}
+
+func (tf TestForest) Children(loc string) []string {
+	return []string{tf.NearbyLocation(loc, nil)}
+}
+
+func (tf TestForest) Distance(from, to string) int {
+	return -1
+}
+
+func (tf TestForest) Trail() []string {
+	return nil
+}
+
+func (tf TestForest) LocationID(loc string) string {
+	return ""
+}
+
+func (tf TestForest) FindLocation(loc, id string, byName bool) string {
+	return ""
+}
+
+func (tf TestForest) Reputation() float64 {
+	return 0
+}
+
 func TestMoving(t *testing.T) {
 	tf := TestForest{}
 	r := NewRabbit(tf)
@@ -47,7 +88,7 @@ func TestMoving(t *testing.T) {
 }
 
 func TestDirectoryForest(t *testing.T) {
-	f := newDirectoryForest()
+	f := newDirectoryForest(baseLocation())
 	t.Logf("%v\n", f);
 }
 
@@ -73,3 +114,535 @@ func TestUtil(t *testing.T) {
 		t.Errorf("%s ascends or descends from %s\n", p1, p3)
 	}
 }
+
+func TestFarawayDepth(t *testing.T) {
+	const depth = 8
+	const samples = 2000
+	root := makeTree(t, 2, depth, 0)
+	defer os.RemoveAll(root)
+
+	f := newDirectoryForest(root)
+	counts := make([]int, depth + 1)
+	for i := 0; i < samples; i++ {
+		counts[pathDepth(root, f.FarawayLocation(""))]++
+	}
+	t.Logf("faraway depths: %v", counts)
+
+	if counts[0] != 0 {
+		t.Errorf("faraway location was the root %d times", counts[0])
+	}
+	// Deep directories are rarer, but with this many samples
+	// every depth should be reached.
+	for d := 1; d <= depth; d++ {
+		if counts[d] == 0 {
+			t.Errorf("faraway location never reached depth %d", d)
+		}
+	}
+	// Each level should be reached about DescendChance times as
+	// often as the one above it.
+	for d := 2; d <= 4; d++ {
+		ratio := float64(counts[d]) / float64(counts[d - 1])
+		if ratio < DescendChance - 0.2 || ratio > DescendChance + 0.2 {
+			t.Errorf("depth %d reached %.2f times as often as depth %d",
+				d, ratio, d - 1)
+		}
+	}
+}
+
+func TestMovements(t *testing.T) {
+	root := makeTree(t, 3, 5, 0)
+	defer os.RemoveAll(root)
+
+	f := newDirectoryForest(root)
+	center := f.FarawayLocation("")
+	for _, name := range []string{"random", "sibling", "burrow", "territory"} {
+		m := newMovement(name, center)
+		if m.Name() != name {
+			t.Errorf("movement %s is named %s", name, m.Name())
+		}
+
+		loc := center
+		for i := 0; i < 200; i++ {
+			path := m.Walk(&f, loc)
+			if len(path) == 0 {
+				t.Fatalf("%s: rabbit couldn't move from %s", name, loc)
+			}
+			past := loc
+			for _, l := range path {
+				d := f.Distance(past, l)
+				sideways := d == 2 && filepath.Dir(past) == filepath.Dir(l)
+				if d != 1 && !sideways {
+					t.Fatalf("%s: %s -> %s isn't one move", name, past, l)
+				}
+				past = l
+			}
+			if past == loc {
+				t.Errorf("%s: rabbit ended where it started", name)
+			}
+			loc = past
+
+			if name == "territory" && f.Distance(center, loc) > TerritoryRadius {
+				t.Errorf("territorial rabbit strayed to %s", loc)
+			}
+		}
+	}
+}
+
+// A forest that only exists in memory. Locations are paths, and
+// every location has the same number of children down to a depth.
+type TreeForest struct {
+	locs	[]string
+	trail	[]string
+}
+
+func NewTreeForest(width, depth int) *TreeForest {
+	tf := &TreeForest{}
+	var grow func(loc string, depth int)
+	grow = func(loc string, depth int) {
+		tf.locs = append(tf.locs, loc)
+		if depth == 0 {
+			return
+		}
+		for i := 0; i < width; i++ {
+			grow(fmt.Sprintf("%s/%d", loc, i), depth - 1)
+		}
+	}
+	grow("/r", depth)
+	return tf
+}
+
+func (tf *TreeForest) LocationExists(loc string) bool {
+	for _, l := range tf.locs {
+		if l == loc {
+			return true
+		}
+	}
+	return false
+}
+
+func (tf *TreeForest) NearbyLocation(loc string, r *Rabbit) string {
+	path := r.Movement().Walk(tf, loc)
+	if len(path) == 0 {
+		return loc
+	}
+	return path[len(path) - 1]
+}
+
+func (tf *TreeForest) FarawayLocation(loc string) string {
+	for {
+		l := randLocation(tf.locs[1:])
+		if l != loc {
+			return l
+		}
+	}
+}
+
+func (tf *TreeForest) FleeLocation(loc string, r *Rabbit) string {
+	return fleeLocation(tf, loc)
+}
+
+func (tf *TreeForest) Mode() *Mode {
+	return lookupMode(DefaultMode)
+}
+
+func (tf *TreeForest) Parent(loc string) string {
+	if loc == "/r" {
+		return ""
+	}
+	return filepath.Dir(loc)
+}
+
+func (tf *TreeForest) Children(loc string) []string {
+	children := []string{}
+	for _, l := range tf.locs {
+		if filepath.Dir(l) == loc {
+			children = append(children, l)
+		}
+	}
+	return children
+}
+
+func (tf *TreeForest) Distance(from, to string) int {
+	fparts := strings.Split(from, "/")
+	tparts := strings.Split(to, "/")
+	shared := 0
+	for shared < len(fparts) && shared < len(tparts) &&
+			fparts[shared] == tparts[shared] {
+		shared++
+	}
+	return len(fparts) + len(tparts) - 2 * shared
+}
+
+func (tf *TreeForest) Trail() []string {
+	return tf.trail
+}
+
+func (tf *TreeForest) LocationID(loc string) string {
+	return ""
+}
+
+func (tf *TreeForest) FindLocation(loc, id string, byName bool) string {
+	return ""
+}
+
+func (tf *TreeForest) Reputation() float64 {
+	return 0
+}
+
+func TestFleeing(t *testing.T) {
+	const samples = 500
+	tf := NewTreeForest(3, 4)
+	tf.trail = []string{"/r/0/1/2", "/r/0/1", "/r/0"}
+
+	nearest := func(loc string) int {
+		n := -1
+		for _, l := range tf.trail {
+			if d := tf.Distance(loc, l); n < 0 || d < n {
+				n = d
+			}
+		}
+		return n
+	}
+
+	fled, faraway := 0, 0
+	for i := 0; i < samples; i++ {
+		loc := fleeLocation(tf, tf.trail[0])
+		if !tf.LocationExists(loc) {
+			t.Fatalf("rabbit fled to %s, which doesn't exist", loc)
+		}
+		fled += nearest(loc)
+		faraway += nearest(tf.FarawayLocation(tf.trail[0]))
+	}
+
+	fledAvg := float64(fled) / samples
+	farawayAvg := float64(faraway) / samples
+	t.Logf("fled %.2f moves away, faraway is %.2f", fledAvg, farawayAvg)
+	if fledAvg < farawayAvg + 1 {
+		t.Errorf("fleeing rabbits don't get far enough away (%.2f <= %.2f)",
+			fledAvg, farawayAvg)
+	}
+
+	// A rabbit with a player that hasn't been anywhere still flees.
+	tf.trail = nil
+	if loc := fleeLocation(tf, "/r/1"); loc == "/r/1" {
+		t.Errorf("rabbit didn't flee")
+	}
+}
+
+func TestTracks(t *testing.T) {
+	fade := TrackFadeTime
+	now := time.Now()
+	fresh := track{now, TrackDescending, "a", "/home/grue/src", false}
+	faint := track{now.Add(-fade / 2), TrackSideways, "b", "/home/grue/data", false}
+	old := track{now.Add(-fade * 5 / 6), TrackDescending, "c", "/home/grue/src", false}
+	up := track{now, TrackAscending, "d", "/home/grue", false}
+
+	tests := []struct {
+		t		track
+		freshness	TrackFreshness
+		hint		string
+	}{
+		{fresh, TrackFresh, "sr…"},
+		{faint, TrackFaint, "d…"},
+		{old, TrackOld, ""},
+		{up, TrackFresh, ""},
+	}
+	for _, test := range tests {
+		if test.t.freshness(fade) != test.freshness {
+			t.Errorf("%v is %s, want %s", test.t, test.t.freshness(fade), test.freshness)
+		}
+		if test.t.hint(fade) != test.hint {
+			t.Errorf("%v hints %q, want %q", test.t, test.t.hint(fade), test.hint)
+		}
+	}
+
+	tl := trackList{}.add(old).add(fresh).add(faint)
+	tl = tl.add(track{now, TrackAscending, "c", "/home/grue", false})
+	if len(tl) != 3 {
+		t.Errorf("rabbit c left two tracks in one place")
+	}
+	tl.sort()
+	if tl[2].Rabbit != "b" {
+		t.Errorf("tracks aren't sorted freshest first: %v", tl)
+	}
+
+	var loaded trackList
+	err := json.Unmarshal([]byte(`{"Timestamp":"2014-01-01T00:00:00Z","Direction":1}`), &loaded)
+	if err != nil || len(loaded) != 1 || loaded[0].Direction != TrackAscending {
+		t.Errorf("couldn't load a track from an old save: %v %v", loaded, err)
+	}
+}
+
+func TestSenses(t *testing.T) {
+	const samples = 1000
+	tf := NewTreeForest(3, 4)
+	rabbit := []scent{{"/r/0/1/2", 1}}
+
+	heard := func(from string) (count int, toward string) {
+		for i := 0; i < samples; i++ {
+			found := sense(tf, from, rabbit, ListenRange, ListenChance)
+			if len(found) > 0 {
+				count++
+				toward = found[0].Toward
+			}
+		}
+		return
+	}
+
+	near, toward := heard("/r/0/1")
+	if toward != "/r/0/1/2" {
+		t.Errorf("rabbit below was heard toward %s", toward)
+	}
+	far, toward := heard("/r/0")
+	if toward != "/r/0/1" {
+		t.Errorf("rabbit two below was heard toward %s", toward)
+	}
+	side, toward := heard("/r/0/1/0")
+	if toward != "/r/0/1" {
+		t.Errorf("rabbit beside was heard toward %s", toward)
+	}
+	if out, _ := heard("/r/1"); out != 0 {
+		t.Errorf("rabbit out of range was heard %d times", out)
+	}
+
+	t.Logf("heard %d/%d one move away, %d/%d two moves away", near, samples, far, samples)
+	if far >= near || side >= near {
+		t.Errorf("rabbits farther away aren't harder to hear")
+	}
+}
+
+func TestMovedLocations(t *testing.T) {
+	root := makeTree(t, 2, 2, 0)
+	defer os.RemoveAll(root)
+	f := newDirectoryForest(root)
+
+	newRabbitAt := func(loc string) *Rabbit {
+		r := NewRabbit(&f)
+		r.setLocation(filepath.Join(root, loc))
+		if r.locationID == "" {
+			t.Skip("no device and inode on this system")
+		}
+		return &r
+	}
+	move := func(from, to string) string {
+		to = filepath.Join(root, to)
+		if err := os.Rename(filepath.Join(root, from), to); err != nil {
+			t.Fatal(err)
+		}
+		return to
+	}
+
+	// Renamed on the same device, the inode stays the same.
+	r := newRabbitAt("dir0/dir1")
+	moved := filepath.Join(move("dir0", "dir1/renamed"), "dir1")
+	if !r.IsPlaying() || r.Location() != moved {
+		t.Errorf("rabbit didn't follow renamed directory (%s!=%s)", r.Location(), moved)
+	}
+
+	// Moved from another device, only the name stays the same.
+	// Pretend the rabbit's directory was on another device.
+	os.Mkdir(filepath.Join(root, "dir1/photos"), 0755)
+	f.scanned = nil
+	r = newRabbitAt("dir1/photos")
+	r.locationID = "999999:1"
+	moved = move("dir1/photos", "dir1/renamed/dir0/photos")
+	r.Displace(time.Now(), CauseMovedAway)
+	if !r.IsPlaying() || r.Location() != moved {
+		t.Errorf("rabbit didn't follow directory from another device (%s!=%s)", r.Location(), moved)
+	}
+
+	// Deleted, another directory of the same name doesn't bring
+	// the rabbit back.
+	f.scanned = nil
+	os.Mkdir(filepath.Join(root, "dir1/renamed/dir0/photos/dir1"), 0755)
+	r = newRabbitAt("dir1/renamed/dir1")
+	r.locationID = "999999:2"
+	os.RemoveAll(filepath.Join(root, "dir1/renamed/dir1"))
+	r.Displace(time.Now().Add(-graceTime), CauseDeleted)
+	if r.IsPlaying() || r.State() != Dead {
+		t.Errorf("rabbit in deleted directory isn't dead (%s)", r.Location())
+	}
+}
+
+func TestGraceTime(t *testing.T) {
+	root := makeTree(t, 2, 2, 0)
+	defer os.RemoveAll(root)
+	f := newDirectoryForest(root)
+
+	loc := filepath.Join(root, "dir0/dir1")
+	r := NewRabbit(&f)
+	r.setLocation(loc)
+
+	// Gone for a moment, like during a rebuild.
+	os.RemoveAll(loc)
+	if !r.IsPlaying() || r.State() != Displaced {
+		t.Fatalf("rabbit in missing directory isn't displaced (%v)", r.State())
+	}
+	if !r.IsPlaying() || r.State() != Displaced {
+		t.Fatalf("displaced rabbit died before the grace time (%v)", r.State())
+	}
+
+	// Back again, the rabbit wanders off.
+	os.Mkdir(loc, 0755)
+	r.DisturbanceAt("")
+	if !r.IsPlaying() || r.State() != Wandering || !f.LocationExists(r.Location()) {
+		t.Errorf("rabbit didn't come back to its directory (%v, %s)", r.State(), r.Location())
+	}
+	if !r.displacedAt.IsZero() {
+		t.Errorf("rabbit is still marked displaced")
+	}
+
+	// Gone for longer than the grace time.
+	os.RemoveAll(r.Location())
+	r.Displace(time.Now().Add(-graceTime), CauseDeleted)
+	if r.IsPlaying() || r.State() != Dead {
+		t.Errorf("rabbit missing past the grace time isn't dead (%v)", r.State())
+	}
+}
+
+func TestMovedEvent(t *testing.T) {
+	root := makeTree(t, 2, 2, 0)
+	defer os.RemoveAll(root)
+	f := newDirectoryForest(root)
+
+	r := NewRabbit(&f)
+	r.setLocation(filepath.Join(root, "dir0/dir1"))
+	if r.locationID == "" {
+		t.Skip("no device and inode on this system")
+	}
+	f.rabbits[r.Location()] = &r
+	state := r.State()
+
+	moved := filepath.Join(root, "dir1/renamed")
+	if err := os.Rename(filepath.Join(root, "dir0"), moved); err != nil {
+		t.Fatal(err)
+	}
+	f.ApplyEvent(fsEvent{time.Now(), filepath.Join(root, "dir0"), "moved"})
+	want := filepath.Join(moved, "dir1")
+	if f.rabbits[want] != &r || r.Location() != want {
+		t.Errorf("rabbit didn't follow its directory to %s (%s)", want, r.Location())
+	}
+	if r.State() != state || !r.displacedAt.IsZero() {
+		t.Errorf("rabbit that followed its directory is %v, want %v", r.State(), state)
+	}
+}
+
+func TestGraveyard(t *testing.T) {
+	root := makeTree(t, 2, 2, 0)
+	defer os.RemoveAll(root)
+	f := newDirectoryForest(root)
+
+	bury := func(loc string, e *fsEvent) *grave {
+		r := NewRabbit(&f)
+		r.setLocation(filepath.Join(root, loc))
+		r.tag = loc
+		f.rabbits[r.Location()] = &r
+		os.RemoveAll(filepath.Join(root, loc))
+		if e != nil {
+			f.ApplyEvent(*e)
+		} else {
+			r.Displace(time.Now().Add(-graceTime), CauseDeleted)
+			f.PerformCheck()
+		}
+		if r.State() != Dead {
+			t.Fatalf("rabbit in %s isn't dead (%v)", loc, r.State())
+		}
+		return f.graves[len(f.graves) - 1]
+	}
+
+	// Seen by the watcher, the player was told right away.
+	died := time.Now().Add(-graceTime * 2)
+	g := bury("dir0/dir1", &fsEvent{died, filepath.Join(root, "dir0"), "moved"})
+	if g.Location != filepath.Join(root, "dir0/dir1") || g.Cause != CauseMovedAway ||
+		!g.Died.Equal(died) || g.Tag != "dir0/dir1" || !g.Noticed {
+		t.Errorf("wrong grave for watched death: %+v", g)
+	}
+
+	// Found dead on a check, the player is told once.
+	g = bury("dir1", nil)
+	if g.Location != filepath.Join(root, "dir1") || g.Cause != CauseDeleted || g.Noticed {
+		t.Errorf("wrong grave for checked death: %+v", g)
+	}
+	if graves := f.unnoticedGraves(); len(graves) != 1 || graves[0] != g {
+		t.Errorf("unnoticedGraves() = %v, want the checked death", graves)
+	}
+	if graves := f.unnoticedGraves(); len(graves) != 0 {
+		t.Errorf("graves were noticed twice: %v", graves)
+	}
+	if f.Stats().Killed != 2 {
+		t.Errorf("killed = %d, want 2", f.Stats().Killed)
+	}
+}
+
+func TestSymlinkJump(t *testing.T) {
+	root := makeTree(t, 2, 2, 0)
+	defer os.RemoveAll(root)
+	from := filepath.Join(root, "dir0", "dir0")
+	to := filepath.Join(root, "dir1", "dir1")
+	if err := os.Symlink(to, filepath.Join(from, "link")); err != nil {
+		t.Skip("no symlinks:", err)
+	}
+	rulesFor(root).followSymlinks = true
+	defer delete(rules, root)
+
+	f := newDirectoryForest(root)
+	if dirs := f.Children(from); len(dirs) != 1 || dirs[0] != to {
+		t.Fatalf("children of %s = %v, want %s", from, dirs, to)
+	}
+	for i := 0; i < 100; i++ {
+		r := NewRabbit(&f)
+		r.setLocation(from)
+		f.NearbyLocation(from, &r)
+	}
+	for _, tr := range f.tracks[from] {
+		if tr.To == to {
+			t.Errorf("jumping through the symlink left a track: %+v", tr)
+		}
+	}
+}
+
+func TestPanicTrail(t *testing.T) {
+	root := makeTree(t, 2, 3, 0)
+	defer os.RemoveAll(root)
+	start, _ := os.Getwd()
+	defer os.Chdir(start)
+
+	f := newDirectoryForest(root)
+	r := NewRabbit(&f)
+	from := filepath.Join(root, "dir0", "dir0", "dir0")
+	to := from
+	for i := 0; i < 100 && to == from; i++ {
+		to = f.FleeLocation(from, &r)
+	}
+	if to == from {
+		t.Fatalf("rabbit never fled from %s", from)
+	}
+
+	// Every step of the way has a panic track to the next.
+	loc := from
+	for _, next := range treePath(from, to) {
+		found := false
+		for _, tr := range f.tracks[loc] {
+			if tr.Panic && tr.Rabbit == r.ID() && tr.To == next {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("no panic track from %s to %s, fleeing from %s to %s", loc, next, from, to)
+		}
+
+		os.Chdir(loc)
+		tr, ok := f.PanicTrailHere()
+		if !ok {
+			t.Fatalf("no panic trail to follow in %s", loc)
+		}
+		want := "The trail leads up. (cd ..)"
+		if !isAscension(next, loc) {
+			want = fmt.Sprintf("The trail leads into %s. (cd %s)", filepath.Base(next), filepath.Base(next))
+		}
+		if got := trailDirection(tr); got != want {
+			t.Errorf("following from %s: %q, want %q", loc, got, want)
+		}
+		loc = next
+	}
+}
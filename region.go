@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The forest is split into regions, one per root. Each region is its
+// own directory forest with its own rabbits, mode and stats.
+type regionSet struct {
+	// Every region ever played, keyed by root. Regions whose root
+	// is no longer chosen are kept so their rabbits aren't lost.
+	regions		map[string]*directoryForest
+	// The chosen roots, in the order they were given.
+	roots		[]string
+	// The player, who hunts in every region.
+	player		*player
+}
+
+// Cleans up a root given by the player. A leading "~" is the home
+// directory.
+func cleanRoot(root string) string {
+	if root == "~" || strings.HasPrefix(root, "~/") {
+		root = filepath.Join(os.Getenv("HOME"), root[1:])
+	}
+	return resolvePath(root)
+}
+
+// Splits a list of roots separated like $PATH. An empty list is just
+// the base location.
+func parseRoots(list string) []string {
+	roots := []string{}
+	seen := map[string]bool{}
+	for _, r := range filepath.SplitList(list) {
+		if r == "" {
+			continue
+		}
+		r = cleanRoot(r)
+		if !seen[r] {
+			seen[r] = true
+			roots = append(roots, r)
+		}
+	}
+	if len(roots) == 0 {
+		roots = append(roots, cleanRoot(baseLocation()))
+	}
+	return roots
+}
+
+// Sets up the regions for the chosen roots. Regions already in the
+// set keep their rabbits. Returns the roots that don't exist, like
+// an unmounted disk. Nothing happens in their regions until they're
+// back.
+func (rs *regionSet) choose(roots []string) (missing []string) {
+	if rs.regions == nil {
+		rs.regions = map[string]*directoryForest{}
+	}
+	if rs.player == nil {
+		rs.player = newPlayer()
+	}
+	rs.roots = roots
+	for _, root := range roots {
+		if _, ok := rs.regions[root]; !ok {
+			df := newDirectoryForest(root)
+			rs.regions[root] = &df
+		}
+		if !rootExists(root) {
+			missing = append(missing, root)
+		}
+	}
+
+	// Roots inside other roots are their own regions, so the outer
+	// region's rabbits stay out of them.
+	for _, outer := range roots {
+		dr := rulesFor(outer)
+		dr.nested = nil
+		for _, inner := range roots {
+			if pathDepth(outer, inner) > 0 {
+				dr.nested = append(dr.nested, inner)
+			}
+		}
+	}
+	return missing
+}
+
+// Returns true if the root is a directory that's there.
+func rootExists(root string) bool {
+	fi, err := os.Stat(root)
+	return err == nil && fi.IsDir()
+}
+
+// Returns the region the location is in. Nested roots win over the
+// roots they're in. Locations outside every root belong to the first
+// root that exists.
+func (rs *regionSet) regionFor(loc string) *directoryForest {
+	best := rs.roots[0]
+	for _, root := range rs.roots {
+		if rootExists(root) {
+			best = root
+			break
+		}
+	}
+	bestDepth := -1
+	for _, root := range rs.roots {
+		if !pathWithin(root, loc) {
+			continue
+		}
+		d := len(pathParts(root))
+		if d > bestDepth {
+			best = root
+			bestDepth = d
+		}
+	}
+	return rs.regions[best]
+}
+
+// Used for marshalling/unmarshalling.
+type regions struct {
+	Regions		map[string]*directoryForest
+	Player		*player	`json:",omitempty"`
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMissingRoot(t *testing.T) {
+	root := makeTree(t, 2, 1, 0)
+	defer os.RemoveAll(root)
+	gone := filepath.Join(root, "unmounted")
+
+	rs := regionSet{}
+	missing := rs.choose([]string{gone, root})
+	if len(missing) != 1 || missing[0] != gone {
+		t.Errorf("missing roots = %v, want %s", missing, gone)
+	}
+	// Outside every root, the first root that's there is played.
+	if df := rs.regionFor("/"); df.root != root {
+		t.Errorf("region outside the roots = %s, want %s", df.root, root)
+	}
+
+	df := rs.regions[gone]
+	df.repopulate()
+	if len(df.rabbits) != 0 {
+		t.Errorf("rabbits spawned in a missing root: %v", df.rabbits)
+	}
+	df.PerformCheck()
+	if df.Stats().Killed != 0 {
+		t.Errorf("checking a missing root killed %d rabbits", df.Stats().Killed)
+	}
+}
+
+func TestReadRegions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rabbit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "save")
+
+	rs, err := readRegions(filename)
+	if err != nil || len(rs.regions) != 0 {
+		t.Errorf("reading a missing save = %v, %v, want no regions", rs, err)
+	}
+
+	f := newDirectoryForest(dir)
+	saveRegions(filename, &regionSet{regions: map[string]*directoryForest{dir: &f}})
+	rs, err = readRegions(filename)
+	if err != nil || rs.regions[dir] == nil {
+		t.Errorf("reading the save = %v, %v, want the region %s", rs, err, dir)
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, ".rabbit*")); len(names) != 0 {
+		t.Errorf("saving left %v behind", names)
+	}
+
+	// Half a save is an error, not the end.
+	bs, _ := ioutil.ReadFile(filename)
+	ioutil.WriteFile(filename, bs[:len(bs) / 2], 0644)
+	if _, err := readRegions(filename); err == nil {
+		t.Errorf("reading half a save didn't fail")
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	// How many moves away rabbits can be heard.
+	ListenRange	= 2
+	// The chance of hearing a rabbit one move away.
+	ListenChance	= 0.80
+	// How many moves away rabbits can be smelled.
+	SniffRange	= 3
+	// The chance of smelling a fresh scent one move away.
+	SniffChance	= 0.70
+	// Each move farther away multiplies the chance by this.
+	SenseFalloff	= 0.5
+	// How long a rabbit's scent lingers where it was. Much
+	// longer than tracks.
+	ScentFadeTime	= IdleTime * 2
+)
+
+// Something a sense can pick up, like a rabbit or its scent.
+type scent struct {
+	Location	string
+	// From 0 to 1, how strong it is where it's from.
+	Strength	float64
+}
+
+// Something noticed by a sense.
+type sensing struct {
+	// The move toward it. A child location, the parent, or "" if
+	// it's right here.
+	Toward		string
+	// The number of moves away it is.
+	Distance	int
+	// How strong it seemed, from 0 to 1. Close and fresh things
+	// are strongest.
+	Strength	float64
+}
+
+// Tries to notice the sources from a location. The chance of
+// noticing one falls off with every move it's away, and nothing
+// farther than the range is noticed. Things the same way are
+// reported once, by the strongest.
+func sense(f Forest, from string, sources []scent, rng int, base float64) []sensing {
+	found := []sensing{}
+	for _, s := range sources {
+		d := f.Distance(from, s.Location)
+		if d < 0 || d > rng {
+			continue
+		}
+		strength := s.Strength * math.Pow(SenseFalloff, math.Max(0, float64(d - 1)))
+		if !chance(base * strength) {
+			continue
+		}
+
+		toward := towards(f, from, s.Location)
+		merged := false
+		for i := range found {
+			if found[i].Toward == toward {
+				if strength > found[i].Strength {
+					found[i] = sensing{toward, d, strength}
+				}
+				merged = true
+			}
+		}
+		if !merged {
+			found = append(found, sensing{toward, d, strength})
+		}
+	}
+	return found
+}
+
+// Returns the first move to take from a location to get to another,
+// "" if they're the same.
+func towards(f Forest, from, to string) string {
+	d := f.Distance(from, to)
+	if d <= 0 {
+		return ""
+	}
+	for _, c := range f.Children(from) {
+		if f.Distance(c, to) == d - 1 {
+			return c
+		}
+	}
+	return f.Parent(from)
+}
+
+// Returns what can be heard in the forest, every rabbit where it is.
+func (f *directoryForest) sounds() []scent {
+	sounds := []scent{}
+	for _, r := range f.rabbits {
+		sounds = append(sounds, scent{r.Location(), 1})
+	}
+	return sounds
+}
+
+// Returns what can be smelled in the forest. Rabbits smell where
+// they are, and where they were until the scent fades.
+func (f *directoryForest) scents() []scent {
+	scents := []scent{}
+	for _, r := range f.rabbits {
+		scents = append(scents, scent{r.Location(), 1})
+		if r.lastLocation == "" {
+			continue
+		}
+		age := time.Now().Sub(r.lastMoved)
+		if age < ScentFadeTime {
+			strength := 1 - float64(age) / float64(ScentFadeTime)
+			scents = append(scents, scent{r.lastLocation, strength})
+		}
+	}
+	return scents
+}
+
+// Listens for rabbits nearby. Must be called after a check, so the
+// rabbits are up to date.
+func (f *directoryForest) Listen() []sensing {
+	return sense(f, currentLocation(), f.sounds(), ListenRange, ListenChance)
+}
+
+// Sniffs for rabbits nearby, and where they've been. Must be called
+// after a check, so the rabbits are up to date.
+func (f *directoryForest) Sniff() []sensing {
+	return sense(f, currentLocation(), f.scents(), SniffRange, SniffChance)
+}
@@ -64,12 +64,18 @@ func (machine *Machine) DelTransition(from State, ev Action) {
 	}
 }
 
+// Returns the state an action on a stateful object would lead to,
+// without performing it. ok is false if it can't be performed.
+func (machine *Machine) Next(ful Stateful, ev Action) (next State, ok bool) {
+	next, exists := machine.Transitions[Transition{ful.State(), ev}]
+	return next, exists && ful.ShouldTransition(ev, next)
+}
+
 // Performs an action on a stateful object using the state machine.
 func (machine *Machine) Perform(ful Stateful, ev Action) bool {
-	next, exists := machine.Transitions[Transition{ful.State(), ev}]
-	if exists && ful.ShouldTransition(ev, next) {
+	next, ok := machine.Next(ful, ev)
+	if ok {
 		ful.EnterState(next)
-		return true
 	}
-	return false
+	return ok
 }
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// Returns true if the file is a terminal someone can answer
+// questions on. Without a way to ask the terminal, any character
+// device will do.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode() & os.ModeCharDevice != 0
+}
+
+// Raw mode needs termios, which is only set up on Linux.
+func makeRaw(f *os.File) (restore func(), err error) {
+	return nil, errors.New("hunting only runs on Linux")
+}
+
+// Without a way to ask the terminal, the size isn't known.
+func terminalSize(f *os.File) (width, height int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// The direction of the tracks indicates where a rabbit went
+// from here.
+type TrackDirection uint
+
+const (
+	// No tracks.
+	TrackNone TrackDirection = iota
+	// Ascending is going "up" a directory, like cd ..
+	TrackAscending
+	// Descending is going "down" a directory, like cd ./data
+	TrackDescending
+	// Sideways is hopping into a sibling, like cd ../data
+	TrackSideways
+)
+
+// How fresh tracks look. Tracks go from fresh, to faint, to old
+// and then fade away.
+type TrackFreshness uint
+
+const (
+	TrackFresh TrackFreshness = iota
+	TrackFaint
+	TrackOld
+)
+
+func (d TrackDirection) String() string {
+	switch d {
+	case TrackAscending: return "ascending"
+	case TrackDescending: return "descending"
+	case TrackSideways: return "heading sideways"
+	default: return "going nowhere"
+	}
+}
+
+func (fr TrackFreshness) String() string {
+	switch fr {
+	case TrackFresh: return "fresh"
+	case TrackFaint: return "faint"
+	default: return "old"
+	}
+}
+
+type track struct {
+	Timestamp	time.Time
+	Direction	TrackDirection
+	// The ID of the rabbit that left the track. May be "" for
+	// tracks from old saves.
+	Rabbit		string
+	// Where the rabbit went. May be "" for tracks from old saves.
+	To		string
+	// Left by a fleeing rabbit. Panic trails fade faster.
+	Panic		bool	`json:",omitempty"`
+}
+
+// Returns how fresh the track looks, given how long tracks take to
+// fade.
+func (t track) freshness(fade time.Duration) TrackFreshness {
+	age := time.Now().Sub(t.Timestamp)
+	switch {
+	case age < fade / 3: return TrackFresh
+	case age < fade * 2 / 3: return TrackFaint
+	default: return TrackOld
+	}
+}
+
+// Returns a hint of which directory the rabbit went into, like
+// "sr…". Fresh tracks give away more than faint ones, and old
+// tracks or tracks going up give nothing away.
+func (t track) hint(fade time.Duration) string {
+	if t.To == "" || t.Direction == TrackAscending {
+		return ""
+	}
+
+	letters := 0
+	switch t.freshness(fade) {
+	case TrackFresh: letters = 2
+	case TrackFaint: letters = 1
+	}
+
+	name := filepath.Base(t.To)
+	if letters == 0 || utf8.RuneCountInString(name) <= letters {
+		return ""
+	}
+	runes := []rune(name)
+	return string(runes[:letters]) + "…"
+}
+
+// The tracks at a location. Each rabbit leaves at most one track per
+// location, the latest.
+type trackList []track
+
+// Adds a track, replacing an older one left by the same rabbit.
+func (tl trackList) add(t track) trackList {
+	for i := range tl {
+		if t.Rabbit != "" && tl[i].Rabbit == t.Rabbit {
+			tl[i] = t
+			return tl
+		}
+	}
+	return append(tl, t)
+}
+
+// Sorts the tracks, freshest first.
+func (tl trackList) sort() {
+	sort.Slice(tl, func(i, j int) bool {
+		return tl[i].Timestamp.After(tl[j].Timestamp)
+	})
+}
+
+// Saves from before a location could have more than one track kept
+// a single track, so either is read.
+func (tl *trackList) UnmarshalJSON(b []byte) error {
+	var list []track
+	if err := json.Unmarshal(b, &list); err == nil {
+		*tl = list
+		return nil
+	}
+	var t track
+	if err := json.Unmarshal(b, &t); err != nil {
+		return err
+	}
+	*tl = trackList{t}
+	return nil
+}
@@ -7,7 +7,6 @@ import (
 	"math"
 	"os"
 	"path/filepath"
-	"strings"
 )
 
 // Uses /dev/urandom to generate random numbers. We don't
@@ -37,20 +36,37 @@ func chance(f float64) bool {
 	return randFloat() < f
 }
 
-// Returns the directory listing as full path names. The passed path
-// must be absolute.
-func listDirs(path string) []string {
+// Returns the directory listing as full path names. Only directories
+// the root's rules allow rabbits into are listed. The passed path
+// must be absolute. Listings come from the directory index when it's
+// up to date.
+func listDirs(root, path string) []string {
 	if !filepath.IsAbs(path) {
 		panic("cannot list dirs on non-absolute path")
 	}
+	return index.list(root, path)
+}
 
+// Reads the directory listing, skipping the index. Use listDirs.
+func readDirs(root, path string) []string {
+	dr := rulesFor(root)
 	dirs := []string{}
 	files, _ := ioutil.ReadDir(path)
 	for _, file := range files {
-		isPrivate := strings.HasPrefix(file.Name(), ".")
-		if file.IsDir() && !isPrivate {
-			dirs = append(dirs, filepath.Join(path, file.Name()))
+		full := filepath.Join(path, file.Name())
+		if !dr.allows(full, file) {
+			continue
+		}
+		// Followed symlinks are listed as where they lead, so
+		// locations stay canonical. Ones leading out of the
+		// root are left alone.
+		if file.Mode() & os.ModeSymlink != 0 {
+			full = resolvePath(full)
+			if !pathWithin(root, full) || full == path {
+				continue
+			}
 		}
+		dirs = append(dirs, full)
 	}
 	return dirs
 }
@@ -58,14 +74,14 @@ func listDirs(path string) []string {
 // Returns true if you can descend from this path, descending is going
 // down a directory, as opposed to up (`cd ..` is up). The passed path
 // must be absolute
-func canDescend(path string) bool {
-	dirs := listDirs(path)
+func canDescend(root, path string) bool {
+	dirs := listDirs(root, path)
 	return len(dirs) > 0
 }
 
 // Returns a random path to desend. The passed path must be absolute.
-func randDescension(path string) string {
-	dirs := listDirs(path)
+func randDescension(root, path string) string {
+	dirs := listDirs(root, path)
 	if len(dirs) == 0 {
 		panic("Tried to descend when unable")
 	}
@@ -73,10 +89,9 @@ func randDescension(path string) string {
 }
 
 // Returns true if you can ascend from this path. No ascending
-// below the home directory. The passed path must be absolute.
-func canAscend(path string) bool {
-	home := os.Getenv("HOME")
-	return strings.HasPrefix(filepath.Dir(path), home)
+// below the root. The passed path must be absolute.
+func canAscend(root, path string) bool {
+	return pathDepth(root, path) > 0
 }
 
 // No need to be random. You can only ascend in one direction.
@@ -84,18 +99,21 @@ func ascend(path string) string {
 	return filepath.Dir(path)
 }
 
-// This is the furthest we can ascend.
+// This is the furthest we can ascend, unless other roots are
+// chosen.
 func baseLocation() string {
 	home := os.Getenv("HOME")
 	return home
 }
 
 // Returns true if the path provided is an ascended location from.
+// That is, to is one of from's parents.
 func isAscension(to string, from string) bool {
-	return strings.HasPrefix(filepath.Dir(from), to)
+	return pathDepth(to, from) > 0
 }
 
 // Returns true if the path provided is a descended location from.
+// That is, to is inside from.
 func isDescension(to string, from string) bool {
-	return strings.HasPrefix(filepath.Dir(to), from)
+	return pathDepth(from, to) > 0
 }
@@ -0,0 +1,134 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// How often the watcher reloads the save file, in case it missed
+// the save being written.
+const WatchRefreshTime = time.Duration(30) * time.Second
+
+// What the watcher listens for on every watched directory.
+const watchMask = syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// Watches the directories rabbits are in and queues an event
+// whenever one is deleted or moved, so kills are caught the moment
+// they happen. Runs until killed.
+func watch(savefile string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	// The save is written whenever rabbits move, so that's when
+	// to look again. It's renamed into place, and may not be there
+	// yet, so its directory is watched.
+	saveDir, saveName := filepath.Split(savefile)
+	saveWd, err := syscall.InotifyAddWatch(fd, saveDir, syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO)
+	if err != nil {
+		return fmt.Errorf("can't watch %s: %v", saveDir, err)
+	}
+
+	bufs := make(chan []byte)
+	go func() {
+		for {
+			buf := make([]byte, 64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1))
+			n, err := syscall.Read(fd, buf)
+			if err != nil {
+				if err == syscall.EINTR {
+					continue
+				}
+				log.Fatal(err)
+			}
+			bufs <- buf[:n]
+		}
+	}()
+
+	watched := map[int32]string{}
+	refresh := func() {
+		rs, err := readRegions(savefile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rabbit: %v\n", err)
+			return
+		}
+		wanted := map[string]bool{}
+		for _, loc := range watchedLocations(rs) {
+			wanted[loc] = true
+		}
+		for wd, loc := range watched {
+			if !wanted[loc] {
+				// The save's directory stays watched.
+				if wd != int32(saveWd) {
+					syscall.InotifyRmWatch(fd, uint32(wd))
+				}
+				delete(watched, wd)
+			}
+		}
+		for loc := range wanted {
+			// Added to the mask, the save's directory may
+			// be one of them.
+			wd, err := syscall.InotifyAddWatch(fd, loc, watchMask | syscall.IN_MASK_ADD)
+			if err == nil {
+				watched[int32(wd)] = loc
+			}
+		}
+	}
+
+	refresh()
+	for {
+		select {
+		case buf := <-bufs:
+			reload := false
+			for off := 0; off + syscall.SizeofInotifyEvent <= len(buf); {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				name := buf[off + syscall.SizeofInotifyEvent:off + syscall.SizeofInotifyEvent + int(ev.Len)]
+				off += syscall.SizeofInotifyEvent + int(ev.Len)
+
+				if ev.Wd == int32(saveWd) && ev.Mask & (syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO) != 0 {
+					if string(bytes.TrimRight(name, "\x00")) == saveName {
+						reload = true
+					}
+					continue
+				}
+				loc, ok := watched[ev.Wd]
+				if !ok {
+					continue
+				}
+
+				cause := ""
+				switch {
+				case ev.Mask & syscall.IN_DELETE_SELF != 0:
+					cause = "deleted"
+				case ev.Mask & syscall.IN_MOVE_SELF != 0:
+					cause = "moved"
+				case ev.Mask & syscall.IN_IGNORED != 0:
+					// The watch is gone, the directory
+					// with it.
+					delete(watched, ev.Wd)
+				}
+				if cause != "" {
+					e := fsEvent{time.Now(), loc, cause}
+					if err := queueEvent(eventsFile(savefile), e); err != nil {
+						fmt.Fprintf(os.Stderr, "rabbit: %v\n", err)
+					}
+				}
+			}
+			if reload {
+				refresh()
+			}
+		case <-time.After(WatchRefreshTime):
+			refresh()
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"errors"
+)
+
+// Watching needs inotify, which only Linux has.
+func watch(savefile string) error {
+	return errors.New("the watcher only runs on Linux")
+}